@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/models/mocks"
+)
+
+func newTestAdmin(t *testing.T) (*admin, *bytes.Buffer) {
+	auditLog := &mocks.AuditModel{}
+	for _, e := range []*models.AuditEntry{
+		{Event: "signup", Details: `email="alice@example.com"`, IP: "192.0.2.1"},
+		{ActorID: 1, Event: "login_success", IP: "192.0.2.1", UserAgent: "Go-http-client/1.1"},
+	} {
+		err := auditLog.Insert(e)
+		assert.NilError(t, err)
+	}
+	var stdout bytes.Buffer
+	return &admin{
+		auditLog: auditLog,
+		users:    &mocks.UserModel{},
+		snippets: &mocks.SnippetModel{},
+		sessions: &mocks.SessionModel{},
+		tokens:   &mocks.TokenModel{},
+		stdin:    strings.NewReader(""),
+		stdout:   &stdout,
+	}, &stdout
+}
+
+func TestAuditExport(t *testing.T) {
+	app, stdout := newTestAdmin(t)
+	err := app.auditExport(nil)
+	assert.NilError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, len(lines), 2)
+	var records []auditRecord
+	for _, line := range lines {
+		var record auditRecord
+		err := json.Unmarshal([]byte(line), &record)
+		assert.NilError(t, err)
+		records = append(records, record)
+	}
+	assert.Equal(t, records[0].Event, "signup")
+	assert.Equal(t, records[1].ActorID, 1)
+	assert.Equal(t, records[1].PrevHash, records[0].Hash)
+}
+
+func TestAuditVerify(t *testing.T) {
+	app, stdout := newTestAdmin(t)
+	err := app.auditVerify(nil)
+	assert.NilError(t, err)
+	assert.StringContains(t, stdout.String(), "intact")
+
+	app.auditLog.(*mocks.AuditModel).Entries[0].Details = "forged"
+	err = app.auditVerify(nil)
+	if err == nil {
+		t.Fatal("got nil; want an error")
+	}
+	assert.StringContains(t, err.Error(), "broken at entry #1")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"GoWebPractice/internal/migrations"
+)
+
+// migrate applies or reverts the schema migrations built into the binary, or
+// shows which have been applied.
+func (app *admin) migrate(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("want up, down or status")
+	}
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(app.db, app.driver)
+		for _, m := range done {
+			fmt.Fprintf(app.stdout, "Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(app.stdout, "The schema is up to date.")
+		}
+		return err
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "Number of migrations to revert")
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		done, err := migrations.Down(app.db, app.driver, *steps)
+		for _, m := range done {
+			fmt.Fprintf(app.stdout, "Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrations.Statuses(app.db, app.driver)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(app.stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.Applied.IsZero() {
+				applied = s.Applied.UTC().Format(time.DateTime)
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q: want up, down or status", args[0])
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/storage"
+)
+
+// TestMigrate runs the migrate commands against a SQLite database, which
+// needs no server.
+func TestMigrate(t *testing.T) {
+	store, err := storage.Open("sqlite", filepath.Join(t.TempDir(), "admin.db"))
+	assert.NilError(t, err)
+	defer store.Close()
+	var stdout bytes.Buffer
+	app := &admin{db: store.DB, driver: store.Driver, stdout: &stdout}
+
+	assert.NilError(t, app.migrate([]string{"up"}))
+	assert.StringContains(t, stdout.String(), "Applied 0001_create_snippets")
+	stdout.Reset()
+	assert.NilError(t, app.migrate([]string{"up"}))
+	assert.Equal(t, stdout.String(), "The schema is up to date.\n")
+
+	stdout.Reset()
+	assert.NilError(t, app.migrate([]string{"down", "-steps", "2"}))
+	assert.Equal(t, strings.Count(stdout.String(), "Reverted"), 2)
+
+	stdout.Reset()
+	assert.NilError(t, app.migrate([]string{"status"}))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.StringContains(t, lines[len(lines)-1], "pending")
+	assert.StringContains(t, lines[1], "0001")
+	if strings.Contains(lines[1], "pending") {
+		t.Errorf("got %q; want 0001 to be applied", lines[1])
+	}
+}
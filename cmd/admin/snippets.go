@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// purgeExpired deletes expired snippets, which are never shown again but
+// are kept in the database until somebody runs this.
+func (app *admin) purgeExpired(args []string) error {
+	flags := flag.NewFlagSet("purge-expired", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	n, err := app.snippets.DeleteExpired()
+	if err != nil {
+		return err
+	}
+	err = app.audit("admin_snippet_purge", "deleted=%d", n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stdout, "Deleted %d expired snippets.\n", n)
+	return nil
+}
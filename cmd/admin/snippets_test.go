@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"GoWebPractice/internal/assert"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	app, stdout := newTestAdmin(t)
+	err := app.purgeExpired(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, stdout.String(), "Deleted 0 expired snippets.\n")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	"GoWebPractice/internal/models"
+)
+
+// stats prints the totals and the per-day numbers from the admin dashboard.
+func (app *admin) stats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	days := flags.Int("days", 14, "Number of days of history to show")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *days < 1 {
+		return fmt.Errorf("-days must be at least 1")
+	}
+
+	// As on the dashboard, a page size of one is the cheapest way to get the
+	// totals out of List.
+	all := models.Filter{Page: 1, PageSize: 1}
+	_, users, err := app.users.List(all)
+	if err != nil {
+		return err
+	}
+	_, snippets, err := app.snippets.List(all)
+	if err != nil {
+		return err
+	}
+	sessions, err := app.sessions.All()
+	if err != nil {
+		return err
+	}
+	signups, err := app.users.SignupsPerDay(*days)
+	if err != nil {
+		return err
+	}
+	created, err := app.snippets.CreatedPerDay(*days)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(app.stdout, "Users:     %d\n", users.TotalRecords)
+	fmt.Fprintf(app.stdout, "Snippets:  %d\n", snippets.TotalRecords)
+	fmt.Fprintf(app.stdout, "Sessions:  %d\n\n", len(sessions))
+	tw := tabwriter.NewWriter(app.stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Day\tSignups\tSnippets\t")
+	for i, day := range signups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t\n", day.Day.Format("2006-01-02"), day.Count, created[i].Count)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"GoWebPractice/internal/assert"
+)
+
+func TestStats(t *testing.T) {
+	app, stdout := newTestAdmin(t)
+	err := app.stats([]string{"-days", "3"})
+	assert.NilError(t, err)
+	out := stdout.String()
+	assert.StringContains(t, out, "Users:     4\n")
+	assert.StringContains(t, out, "Sessions:  2\n")
+	// The totals, a blank line, the heading and one line per day.
+	assert.Equal(t, strings.Count(out, "\n"), 3+1+1+3)
+
+	err = app.stats([]string{"-days", "0"})
+	if err == nil {
+		t.Fatal("got nil; want an error")
+	}
+}
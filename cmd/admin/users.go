@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+)
+
+// findUser looks a user up by ID or email address, whichever arg is.
+func (app *admin) findUser(arg string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if id, convErr := strconv.Atoi(arg); convErr == nil {
+		user, err = app.users.Get(id)
+	} else {
+		user, err = app.users.GetByEmail(arg)
+	}
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, fmt.Errorf("no user %q", arg)
+	}
+	return user, err
+}
+
+// userArg parses flags and returns the user named by the one remaining
+// argument.
+func (app *admin) userArg(flags *flag.FlagSet, args []string) (*models.User, error) {
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("want exactly one user ID or email address")
+	}
+	return app.findUser(flags.Arg(0))
+}
+
+// newPassword returns the first line of standard input if fromStdin is set,
+// and otherwise a new random password, which the caller must print.
+func (app *admin) newPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		b := make([]byte, 15)
+		_, err = rand.Read(b)
+		if err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+	line, err := bufio.NewReader(app.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("reading the password: %w", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	// The same rule as the signup form.
+	if !validator.MinChars(password, 8) {
+		return "", false, fmt.Errorf("the password must be at least 8 characters long")
+	}
+	return password, false, nil
+}
+
+// createUser creates an account, with a generated password unless one is
+// given on standard input.
+func (app *admin) createUser(args []string) error {
+	flags := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	name := flags.String("name", "", "Name of the user")
+	email := flags.String("email", "", "Email address of the user")
+	role := flags.String("role", string(models.RoleUser), "Role of the user: user, moderator or admin")
+	fromStdin := flags.Bool("password-stdin", false, "Read the password from standard input instead of generating one")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if !validator.NotBlank(*name) {
+		return fmt.Errorf("-name is required")
+	}
+	if !validator.Matches(*email, validator.EmailRX) {
+		return fmt.Errorf("-email must be a valid email address")
+	}
+	if !validator.PermittedValue(models.Role(*role), models.Roles...) {
+		return fmt.Errorf("-role must be user, moderator or admin")
+	}
+	password, generated, err := app.newPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+
+	err = app.users.Insert(*name, *email, password)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			return fmt.Errorf("%s is already in use", *email)
+		}
+		return err
+	}
+	user, err := app.users.GetByEmail(*email)
+	if err != nil {
+		return err
+	}
+	if models.Role(*role) != models.RoleUser {
+		err = app.users.SetRole(user.ID, models.Role(*role))
+		if err != nil {
+			return err
+		}
+	}
+	err = app.audit("admin_user_create", "user_id=%d email=%q role=%s", user.ID, user.Email, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stdout, "Created %s #%d %s.\n", *role, user.ID, user.Email)
+	if generated {
+		fmt.Fprintf(app.stdout, "Password: %s\n", password)
+	}
+	return nil
+}
+
+// resetPassword sets a new password for a user who has forgotten theirs.
+// Their sessions and API tokens are revoked, in case the reset is because the
+// account was taken over.
+func (app *admin) resetPassword(args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	fromStdin := flags.Bool("password-stdin", false, "Read the password from standard input instead of generating one")
+	user, err := app.userArg(flags, args)
+	if err != nil {
+		return err
+	}
+	password, generated, err := app.newPassword(*fromStdin)
+	if err != nil {
+		return err
+	}
+	err = app.users.SetPassword(user.ID, password)
+	if err != nil {
+		return err
+	}
+	err = app.sessions.DeleteOthers(user.ID, "")
+	if err != nil {
+		return err
+	}
+	tokens, err := app.tokens.DeleteAll(user.ID)
+	if err != nil {
+		return err
+	}
+	err = app.audit("admin_password_reset", "user_id=%d tokens_revoked=%d", user.ID, tokens)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stdout, "Reset the password of #%d %s, logged them out and revoked %d API tokens.\n", user.ID, user.Email, tokens)
+	if generated {
+		fmt.Fprintf(app.stdout, "Password: %s\n", password)
+	}
+	return nil
+}
+
+// deactivate does the same as the button on the admin user page: the user
+// can no longer log in, but their data is kept.
+func (app *admin) deactivate(args []string) error {
+	flags := flag.NewFlagSet("deactivate", flag.ContinueOnError)
+	user, err := app.userArg(flags, args)
+	if err != nil {
+		return err
+	}
+	if !user.Active {
+		fmt.Fprintf(app.stdout, "#%d %s is already deactivated.\n", user.ID, user.Email)
+		return nil
+	}
+	err = app.users.SetActive(user.ID, false)
+	if err != nil {
+		return err
+	}
+	err = app.sessions.DeleteOthers(user.ID, "")
+	if err != nil {
+		return err
+	}
+	err = app.audit("admin_user_deactivate", "user_id=%d", user.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(app.stdout, "Deactivated #%d %s.\n", user.ID, user.Email)
+	return nil
+}
+
+// listSessions prints the logged-in sessions, most recently used first.
+func (app *admin) listSessions(args []string) error {
+	flags := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	var sessions []*models.Session
+	switch flags.NArg() {
+	case 0:
+		sessions, err = app.sessions.All()
+	case 1:
+		var user *models.User
+		user, err = app.findUser(flags.Arg(0))
+		if err == nil {
+			sessions, err = app.sessions.ForUser(user.ID)
+		}
+	default:
+		return fmt.Errorf("want at most one user ID or email address")
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(app.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tIP\tCREATED\tLAST SEEN\tEXPIRES\tUSER AGENT")
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", s.UserID, s.IP, s.Created.UTC().Format(time.DateTime),
+			s.LastSeen.UTC().Format(time.DateTime), s.Expires.UTC().Format(time.DateTime), s.UserAgent)
+	}
+	return tw.Flush()
+}
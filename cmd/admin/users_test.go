@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/models/mocks"
+)
+
+func TestUserCommands(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        func(app *admin, args []string) error
+		args       []string
+		stdin      string
+		wantErr    string
+		wantStdout string
+		wantEvent  string
+	}{
+		{name: "Create user", run: (*admin).createUser, args: []string{"-name", "Bob", "-email", "bob@example.com"}, wantStdout: "Created user #100 bob@example.com.\nPassword: ", wantEvent: "admin_user_create"},
+		{name: "Create admin", run: (*admin).createUser, args: []string{"-name", "Eve", "-email", "eve@example.com", "-role", "admin", "-password-stdin"}, stdin: "correct horse\n", wantStdout: "Created admin #100 eve@example.com.\n", wantEvent: "admin_user_create"},
+		{name: "Create short password", run: (*admin).createUser, args: []string{"-name", "Bob", "-email", "bob@example.com", "-password-stdin"}, stdin: "hunter2\n", wantErr: "at least 8 characters"},
+		{name: "Create duplicate", run: (*admin).createUser, args: []string{"-name", "Bob", "-email", "dupe@example.com"}, wantErr: "dupe@example.com is already in use"},
+		{name: "Create bad role", run: (*admin).createUser, args: []string{"-name", "Bob", "-email", "bob@example.com", "-role", "root"}, wantErr: "-role must be"},
+		{name: "Create without name", run: (*admin).createUser, args: []string{"-email", "bob@example.com"}, wantErr: "-name is required"},
+		{name: "Reset password", run: (*admin).resetPassword, args: []string{"alice@example.com"}, wantStdout: "Reset the password of #1 alice@example.com, logged them out and revoked 2 API tokens.", wantEvent: "admin_password_reset"},
+		{name: "Reset password by ID", run: (*admin).resetPassword, args: []string{"-password-stdin", "1"}, stdin: "correct horse", wantStdout: "Reset the password of #1", wantEvent: "admin_password_reset"},
+		{name: "Reset password unknown user", run: (*admin).resetPassword, args: []string{"nobody@example.com"}, wantErr: `no user "nobody@example.com"`},
+		{name: "Deactivate", run: (*admin).deactivate, args: []string{"alice@example.com"}, wantStdout: "Deactivated #1 alice@example.com.", wantEvent: "admin_user_deactivate"},
+		{name: "Deactivate inactive", run: (*admin).deactivate, args: []string{"carol@example.com"}, wantStdout: "already deactivated"},
+		{name: "Deactivate without user", run: (*admin).deactivate, wantErr: "want exactly one user"},
+		{name: "All sessions", run: (*admin).listSessions, wantStdout: "Mozilla/5.0"},
+		{name: "Sessions of a user", run: (*admin).listSessions, args: []string{"mod@example.com"}, wantStdout: "USER  IP  CREATED  LAST SEEN  EXPIRES  USER AGENT\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, stdout := newTestAdmin(t)
+			app.stdin = strings.NewReader(tt.stdin)
+			events := len(app.auditLog.(*mocks.AuditModel).Entries)
+			err := tt.run(app, tt.args)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("got nil; want an error containing %q", tt.wantErr)
+				}
+				assert.StringContains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.StringContains(t, stdout.String(), tt.wantStdout)
+			logged := app.auditLog.(*mocks.AuditModel).Events()[events:]
+			if tt.wantEvent == "" {
+				assert.Equal(t, len(logged), 0)
+			} else {
+				assert.Equal(t, strings.Join(logged, ","), tt.wantEvent)
+			}
+		})
+	}
+}
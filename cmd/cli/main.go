@@ -0,0 +1,15 @@
+// Command snippetbox is a command-line client for the Snippetbox JSON API.
+// Run it without arguments for a list of commands. The commands themselves
+// are in internal/cli.
+package main
+
+import (
+	"os"
+
+	"GoWebPractice/internal/cli"
+)
+
+func main() {
+	c := &cli.CLI{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	os.Exit(c.Run(os.Args[1:]))
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// adminPageSize is the number of rows shown on each page of the admin lists.
+const adminPageSize = 20
+
+// maxPage is the highest page number readFilter passes on, so that the offset
+// of the page can't overflow. Pages past the last one are simply empty.
+const maxPage = 100_000
+
+// adminStatsDays is how many days of history the dashboard charts show.
+const adminStatsDays = 14
+
+// adminDashboard holds the numbers shown on the admin dashboard.
+type adminDashboard struct {
+	TotalUsers     int
+	TotalSnippets  int
+	SignupsPerDay  []models.DailyCount
+	SnippetsPerDay []models.DailyCount
+}
+
+// readFilter reads the search query and page number from the query string.
+// A missing or invalid page number means the first page, and one above
+// maxPage means maxPage.
+func readFilter(r *http.Request) models.Filter {
+	qs := r.URL.Query()
+	page, err := strconv.Atoi(qs.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	page = min(page, maxPage)
+	return models.Filter{Query: qs.Get("q"), Page: page, PageSize: adminPageSize}
+}
+
+func (app *application) adminDashboard(w http.ResponseWriter, r *http.Request) {
+	dashboard := &adminDashboard{}
+	// An empty filter with a page size of one is the cheapest way to get
+	// the total number of records out of List.
+	all := models.Filter{Page: 1, PageSize: 1}
+	_, metadata, err := app.users.List(all)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	dashboard.TotalUsers = metadata.TotalRecords
+	_, metadata, err = app.snippets.List(all)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	dashboard.TotalSnippets = metadata.TotalRecords
+	dashboard.SignupsPerDay, err = app.users.SignupsPerDay(adminStatsDays)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	dashboard.SnippetsPerDay, err = app.snippets.CreatedPerDay(adminStatsDays)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Dashboard = dashboard
+	app.render(w, r, http.StatusOK, "admin.tmpl", data)
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	filter := readFilter(r)
+	users, metadata, err := app.users.List(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Metadata = metadata
+	data.Query = filter.Query
+	app.render(w, r, http.StatusOK, "admin-users.tmpl", data)
+}
+
+// userFromParams loads the user whose ID is in the :id route parameter. It
+// sends a 404 and returns nil if there is no such user.
+func (app *application) userFromParams(w http.ResponseWriter, r *http.Request) *models.User {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return nil
+	}
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+	return user
+}
+
+func (app *application) adminUserView(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromParams(w, r)
+	if user == nil {
+		return
+	}
+	data := app.newTemplateData(r)
+	data.User = user
+	data.Roles = models.Roles
+	app.render(w, r, http.StatusOK, "admin-user.tmpl", data)
+}
+
+func (app *application) adminUserDeactivatePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserActive(w, r, false)
+}
+
+func (app *application) adminUserReactivatePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetUserActive(w, r, true)
+}
+
+func (app *application) adminSetUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	user := app.userFromParams(w, r)
+	if user == nil {
+		return
+	}
+	// Like their role, admins can't deactivate their own account, so that
+	// there is always at least one admin left.
+	if user.ID == app.authenticatedUser(r).ID {
+		app.sessionManager.Put(r.Context(), "flash", "You can't deactivate your own account here.")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+		return
+	}
+	err := app.users.SetActive(user.ID, active)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if active {
+		app.audit(r, "admin_user_reactivate", "user_id=%d", user.ID)
+		app.sessionManager.Put(r.Context(), "flash", "The account has been reactivated.")
+	} else {
+		app.audit(r, "admin_user_deactivate", "user_id=%d", user.ID)
+		app.sessionManager.Put(r.Context(), "flash", "The account has been deactivated.")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+// adminUserRolePost changes the role of a user. Admins can't change their own
+// role, so that there is always at least one admin left.
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	user := app.userFromParams(w, r)
+	if user == nil {
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	role := models.Role(r.PostForm.Get("role"))
+	if !validator.PermittedValue(role, models.Roles...) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	adminID := app.authenticatedUser(r).ID
+	if user.ID == adminID {
+		app.sessionManager.Put(r.Context(), "flash", "You can't change your own role.")
+		http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+		return
+	}
+	err = app.users.SetRole(user.ID, role)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "admin_user_role", "user_id=%d role=%s", user.ID, role)
+	app.sessionManager.Put(r.Context(), "flash", "The role has been updated.")
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", user.ID), http.StatusSeeOther)
+}
+
+func (app *application) adminSnippets(w http.ResponseWriter, r *http.Request) {
+	filter := readFilter(r)
+	snippets, metadata, err := app.snippets.List(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Metadata = metadata
+	data.Query = filter.Query
+	app.render(w, r, http.StatusOK, "admin-snippets.tmpl", data)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetSnippetDeleted(w, r, true)
+}
+
+func (app *application) adminSnippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetSnippetDeleted(w, r, false)
+}
+
+func (app *application) adminSetSnippetDeleted(w http.ResponseWriter, r *http.Request, deleted bool) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+	err = app.snippets.SetDeleted(id, deleted)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	if deleted {
+		app.audit(r, "admin_snippet_delete", "snippet_id=%d", id)
+		app.sessionManager.Put(r.Context(), "flash", "The snippet has been deleted.")
+	} else {
+		app.audit(r, "admin_snippet_restore", "snippet_id=%d", id)
+		app.sessionManager.Put(r.Context(), "flash", "The snippet has been restored.")
+	}
+	http.Redirect(w, r, "/admin/snippets", http.StatusSeeOther)
+}
+
+// adminAudit shows the audit log, newest first. The hash chain is only
+// checked when asked for, as that means reading the whole log.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	filter := readFilter(r)
+	entries, metadata, err := app.auditLog.List(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.AuditEntries = entries
+	data.Metadata = metadata
+	data.Query = filter.Query
+	if r.URL.Query().Has("verify") {
+		brokenID, err := app.auditLog.Verify()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.AuditVerified = true
+		data.AuditBrokenID = brokenID
+	}
+	app.render(w, r, http.StatusOK, "admin-audit.tmpl", data)
+}
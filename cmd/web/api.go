@@ -0,0 +1,359 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxAPIBodyBytes limits the size of JSON request bodies.
+const maxAPIBodyBytes = 1 << 20
+
+// apiPageSize is the number of snippets in each page of search results.
+const apiPageSize = 20
+
+// envelope wraps every JSON response in an object, so that fields can be added
+// next to the data later without breaking clients.
+type envelope map[string]any
+
+// apiSnippet is a snippet as it appears in the JSON API.
+type apiSnippet struct {
+	ID      int       `json:"id"`
+	UserID  int       `json:"user_id,omitempty"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// apiMetadata is models.Metadata with JSON field names, sent with search
+// results.
+type apiMetadata struct {
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	LastPage     int `json:"last_page"`
+	TotalRecords int `json:"total_records"`
+}
+
+func newAPISnippet(s *models.Snippet) apiSnippet {
+	return apiSnippet{
+		ID:      s.ID,
+		UserID:  s.UserID,
+		Title:   s.Title,
+		Content: s.Content,
+		Created: s.Created,
+		Expires: s.Expires,
+	}
+}
+
+// apiSnippetInput is the request body for creating and updating snippets.
+type apiSnippetInput struct {
+	Title               string `json:"title"`
+	Content             string `json:"content"`
+	Expires             int    `json:"expires"`
+	ConfirmSecrets      bool   `json:"confirm_secrets"`
+	validator.Validator `json:"-"`
+}
+
+// writeJSON sends data as JSON with the given status code.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		// There's no request here to log with, and no point trying to encode
+		// another envelope, so this is the one place which logs without the
+		// request ID and sends a canned body.
+		app.logError(context.Background(), err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error": "the server encountered a problem and could not process your request"}` + "\n"))
+		return
+	}
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// readJSON decodes a JSON request body into dst. The body must be a single
+// JSON object with no unknown fields, sent with a JSON content type.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) (int, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, errors.New("the request body must be JSON (Content-Type: application/json)")
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &syntaxError):
+			return http.StatusBadRequest, fmt.Errorf("the body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return http.StatusBadRequest, errors.New("the body contains badly-formed JSON")
+		case errors.As(err, &typeError):
+			return http.StatusBadRequest, fmt.Errorf("the body contains the wrong type for the %q field", typeError.Field)
+		case errors.Is(err, io.EOF):
+			return http.StatusBadRequest, errors.New("the body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return http.StatusBadRequest, fmt.Errorf("the body contains unknown field %s", field)
+		case errors.As(err, &maxBytesError):
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("the body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return http.StatusBadRequest, err
+		}
+	}
+	if dec.More() {
+		return http.StatusBadRequest, errors.New("the body must only contain a single JSON value")
+	}
+	return 0, nil
+}
+
+// apiError sends an error message as JSON.
+func (app *application) apiError(w http.ResponseWriter, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": message}, nil)
+}
+
+// apiServerError logs the error and sends a generic 500 response as JSON.
+func (app *application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r.Context(), err)
+	body := app.serverErrorBody(r, "the server encountered a problem and could not process your request")
+	app.writeJSON(w, http.StatusInternalServerError, body, nil)
+}
+
+// serverErrorBody is the JSON body of a 500 response, which carries the
+// request ID as well as the message.
+func (app *application) serverErrorBody(r *http.Request, message string) envelope {
+	body := envelope{"error": message}
+	if info := requestInfoFrom(r.Context()); info != nil {
+		body["request_id"] = info.id
+	}
+	return body
+}
+
+// apiValidationError sends the validator's errors as a 422 response. Field
+// errors are keyed by the JSON field name.
+func (app *application) apiValidationError(w http.ResponseWriter, v validator.Validator, extra envelope) {
+	body := envelope{"error": "validation failed"}
+	if len(v.FieldErrors) > 0 {
+		body["fields"] = v.FieldErrors
+	}
+	if len(v.NonFieldErrors) > 0 {
+		body["errors"] = v.NonFieldErrors
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	app.writeJSON(w, http.StatusUnprocessableEntity, body, nil)
+}
+
+// requireAPIAuthentication is the JSON API's version of requireAuthentication:
+// it answers with 401 instead of redirecting to the login page.
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			app.apiError(w, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+		w.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readIDParam returns the :id route parameter, or zero if it isn't a valid ID.
+func readIDParam(r *http.Request) int {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+// apiSnippetList returns the latest snippets or, if there is a q parameter,
+// a page of the snippets which match it.
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	var (
+		snippets []*models.Snippet
+		metadata models.Metadata
+		err      error
+	)
+	search := r.URL.Query().Has("q")
+	if search {
+		f := readFilter(r)
+		f.PageSize = apiPageSize
+		snippets, metadata, err = app.snippets.Search(f)
+	} else {
+		snippets, err = app.snippets.Latest()
+	}
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	list := make([]apiSnippet, 0, len(snippets))
+	for _, s := range snippets {
+		list = append(list, newAPISnippet(s))
+	}
+	body := envelope{"snippets": list}
+	if search {
+		body["metadata"] = apiMetadata(metadata)
+	}
+	app.writeJSON(w, http.StatusOK, body, nil)
+}
+
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	id := readIDParam(r)
+	if id == 0 {
+		app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet)}, nil)
+}
+
+// readSnippetInput decodes and validates the body of a create or update
+// request. It sends the error response itself and returns false if the input
+// can't be used.
+func (app *application) readSnippetInput(w http.ResponseWriter, r *http.Request) (*apiSnippetInput, bool) {
+	var input apiSnippetInput
+	status, err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, status, err.Error())
+		return nil, false
+	}
+	secrets := app.validateSnippet(&input.Validator, input.Title, input.Content, input.Expires, input.ConfirmSecrets)
+	if !input.Valid() {
+		var extra envelope
+		if len(secrets) > 0 && !input.ConfirmSecrets {
+			extra = envelope{"secrets": secrets}
+		}
+		app.apiValidationError(w, input.Validator, extra)
+		return nil, false
+	}
+	return &input, true
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	input, ok := app.readSnippetInput(w, r)
+	if !ok {
+		return
+	}
+	id, err := app.snippets.Insert(app.authenticatedUser(r).ID, input.Title, input.Content, input.Expires)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	app.audit(r, "snippet_create", "snippet_id=%d", id)
+	app.snippetEvent(r.Context(), app.authenticatedUser(r).ID, models.EventSnippetCreated, id)
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+	app.writeJSON(w, http.StatusCreated, envelope{"snippet": newAPISnippet(snippet)}, headers)
+}
+
+// ownSnippet checks that the snippet in the :id parameter exists and belongs
+// to the authenticated user. It sends the error response itself and returns
+// zero otherwise.
+func (app *application) ownSnippet(w http.ResponseWriter, r *http.Request) int {
+	id := readIDParam(r)
+	if id == 0 {
+		app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		return 0
+	}
+	// Go through Get first, so that hidden snippets look the same as missing
+	// ones to everybody.
+	_, err := app.snippets.Get(id)
+	if err == nil {
+		var ownerID int
+		ownerID, err = app.snippets.Owner(id)
+		if err == nil && ownerID != app.authenticatedUser(r).ID {
+			app.apiError(w, http.StatusForbidden, "you can only change your own snippets")
+			return 0
+		}
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return 0
+	}
+	return id
+}
+
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	id := app.ownSnippet(w, r)
+	if id == 0 {
+		return
+	}
+	input, ok := app.readSnippetInput(w, r)
+	if !ok {
+		return
+	}
+	err := app.snippets.Update(id, input.Title, input.Content, input.Expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "snippet_update", "snippet_id=%d", id)
+	app.snippetEvent(r.Context(), app.authenticatedUser(r).ID, models.EventSnippetUpdated, id)
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, http.StatusOK, envelope{"snippet": newAPISnippet(snippet)}, nil)
+}
+
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	id := app.ownSnippet(w, r)
+	if id == 0 {
+		return
+	}
+	err := app.snippets.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "snippet_delete", "snippet_id=%d", id)
+	app.snippetEvent(r.Context(), app.authenticatedUser(r).ID, models.EventSnippetDeleted, id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"GoWebPractice/internal/config"
+)
+
+// loadConfig works out the configuration from the command-line arguments
+// (without the program name) and the environment, with a flag for every
+// setting (see internal/config). printConfig reports whether -print-config
+// was given. Flag errors and -help are written to output; for -help the error
+// is flag.ErrHelp.
+func loadConfig(args []string, lookupEnv func(string) (string, bool), output io.Writer) (cfg config.Config, printConfig bool, err error) {
+	cfg = config.Default()
+	fs := flag.NewFlagSet("web", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.BoolVar(&printConfig, "print-config", false, "Print the configuration, with secrets redacted, and exit")
+	cfg.Flags(fs)
+	err = cfg.Load(fs, args, lookupEnv)
+	if err != nil {
+		return cfg, false, err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(output, "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return cfg, false, errors.New("too many arguments")
+	}
+	return cfg, printConfig, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"testing"
+
+	"GoWebPractice/internal/assert"
+)
+
+// The settings themselves are tested in internal/config.
+func TestLoadConfig(t *testing.T) {
+	cfg, printConfig, err := loadConfig([]string{"-print-config", "-addr", ":5000"}, func(string) (string, bool) { return "", false }, io.Discard)
+	assert.NilError(t, err)
+	assert.Equal(t, printConfig, true)
+	assert.Equal(t, cfg.Addr, ":5000")
+
+	// -print-config is not a setting, so it has no environment variable.
+	env := func(key string) (string, bool) {
+		if key == "SNIPPETBOX_PRINT_CONFIG" {
+			return "true", true
+		}
+		return "", false
+	}
+	_, printConfig, err = loadConfig(nil, env, io.Discard)
+	assert.NilError(t, err)
+	assert.Equal(t, printConfig, false)
+
+	_, _, err = loadConfig([]string{"serve"}, env, io.Discard)
+	assert.StringContains(t, err.Error(), "too many arguments")
+
+	_, _, err = loadConfig([]string{"-help"}, env, io.Discard)
+	assert.Equal(t, errors.Is(err, flag.ErrHelp), true)
+}
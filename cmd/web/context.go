@@ -1,8 +1,34 @@
 package main
 
+import "context"
+
+// 因為應用程式使用的其他第三方套件也可能用相同的字串（例如“authenticatedUser”）作為鍵儲存資料 - 這會導致命名衝突。
+// 為了避免這種情況，最好建立自己的自訂類型，並將其用作上下文鍵。
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
+// The authenticate middleware stores the *models.User making the request
+// under this key. It is only set for authenticated users.
+const authenticatedUserContextKey = contextKey("authenticatedUser")
 
-//因為存在應用程式使用的其他第三方套件也希望使用“isAuthenticated”鍵儲存資料的風險 - 這會導致命名衝突。
-// 為了避免這種情況，最好建立自己的自訂類型，並將其用作上下文鍵。
+// The authenticateToken middleware stores the scope of the API token used for
+// the request under this key. Requests authenticated with a session cookie
+// don't have it.
+const tokenScopeContextKey = contextKey("tokenScope")
+
+// The requestID middleware stores a *requestInfo for every request under this
+// key. Later middleware fill it in as they find out more, and since it's a
+// pointer, the logger sees that even through the context of a request made
+// earlier in the chain, like the one logRequest has.
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo is what the logger adds to every line logged for a request.
+type requestInfo struct {
+	id     string
+	userID int
+}
+
+// requestInfoFrom returns the requestInfo in ctx, or nil outside a request.
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	return info
+}
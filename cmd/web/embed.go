@@ -0,0 +1,168 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The embed iframe is embedWidth by embedHeight pixels, unless the consumer
+// asks for something smaller with maxwidth and maxheight.
+const (
+	embedWidth  = 600
+	embedHeight = 400
+)
+
+// oEmbedResponse is a "rich" oEmbed response (https://oembed.com). The
+// spec wants a flat object, so it isn't wrapped in an envelope.
+type oEmbedResponse struct {
+	XMLName      xml.Name `json:"-" xml:"oembed"`
+	Type         string   `json:"type" xml:"type"`
+	Version      string   `json:"version" xml:"version"`
+	Title        string   `json:"title" xml:"title"`
+	AuthorName   string   `json:"author_name,omitempty" xml:"author_name,omitempty"`
+	ProviderName string   `json:"provider_name" xml:"provider_name"`
+	ProviderURL  string   `json:"provider_url" xml:"provider_url"`
+	CacheAge     int      `json:"cache_age" xml:"cache_age"`
+	HTML         string   `json:"html" xml:"html"`
+	Width        int      `json:"width" xml:"width"`
+	Height       int      `json:"height" xml:"height"`
+}
+
+// embeddedSnippetID returns the ID of the snippet which rawURL points to, or
+// zero if it isn't the address of a snippet on this site. Both the snippet
+// page and the embed page are accepted.
+func embeddedSnippetID(rawURL, host string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.EqualFold(u.Host, host) || (u.Scheme != "http" && u.Scheme != "https") {
+		return 0
+	}
+	var rest string
+	for _, prefix := range []string{"/snippet/view/", "/embed/"} {
+		if strings.HasPrefix(u.Path, prefix) {
+			rest = strings.TrimPrefix(u.Path, prefix)
+		}
+	}
+	id, err := strconv.Atoi(rest)
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+// boundedSize returns def, or the value of the query string parameter if that
+// is smaller.
+func boundedSize(qs url.Values, key string, def int) int {
+	max, err := strconv.Atoi(qs.Get(key))
+	if err != nil || max < 1 || max > def {
+		return def
+	}
+	return max
+}
+
+// oEmbed answers oEmbed requests for snippets. Errors use the status codes
+// from the spec: 404 for URLs which aren't snippets and 501 for formats other
+// than JSON and XML.
+func (app *application) oEmbed(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	format := qs.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "xml" {
+		app.clientError(w, r, http.StatusNotImplemented)
+		return
+	}
+	if qs.Get("url") == "" {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	id := embeddedSnippetID(qs.Get("url"), r.Host)
+	if id == 0 {
+		app.notFound(w, r)
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	base := siteURL(r)
+	width := boundedSize(qs, "maxwidth", embedWidth)
+	height := boundedSize(qs, "maxheight", embedHeight)
+	res := oEmbedResponse{
+		Type:         "rich",
+		Version:      "1.0",
+		Title:        snippet.Title,
+		ProviderName: "Snippetbox",
+		ProviderURL:  base + "/",
+		CacheAge:     int(time.Hour.Seconds()),
+		HTML: fmt.Sprintf(`<iframe src="%s/embed/%d" width="%d" height="%d" title="%s" frameborder="0" loading="lazy"></iframe>`,
+			base, snippet.ID, width, height, template.HTMLEscapeString(snippet.Title)),
+		Width:  width,
+		Height: height,
+	}
+	if snippet.UserID != 0 {
+		user, err := app.users.Get(snippet.UserID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if user != nil {
+			res.AuthorName = user.Name
+		}
+	}
+
+	var body []byte
+	if format == "xml" {
+		body, err = xml.MarshalIndent(res, "", "  ")
+		body = append([]byte(xml.Header), body...)
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	} else {
+		body, err = json.Marshal(res)
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	w.Write(body)
+}
+
+// snippetEmbed shows a snippet on its own, for iframes on other sites. It
+// runs without sessions: there is nothing to log in to, and cookies aren't
+// sent to third-party frames anyway.
+func (app *application) snippetEmbed(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	data := &templateData{CurrentYear: time.Now().Year(), Snippet: snippet}
+	app.renderLayout(w, r, http.StatusOK, "embed.tmpl", "embed", data)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"GoWebPractice/internal/assert"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOEmbed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	snippetURL := ts.URL + "/snippet/view/1"
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantCode   int
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "JSON", query: url.Values{"url": {snippetURL}}, wantCode: http.StatusOK, wantWidth: embedWidth, wantHeight: embedHeight},
+		{name: "XML", query: url.Values{"url": {snippetURL}, "format": {"xml"}}, wantCode: http.StatusOK, wantWidth: embedWidth, wantHeight: embedHeight},
+		{name: "Embed URL", query: url.Values{"url": {ts.URL + "/embed/1"}}, wantCode: http.StatusOK, wantWidth: embedWidth, wantHeight: embedHeight},
+		{name: "Max size", query: url.Values{"url": {snippetURL}, "maxwidth": {"300"}, "maxheight": {"9999"}}, wantCode: http.StatusOK, wantWidth: 300, wantHeight: embedHeight},
+		{name: "Unsupported format", query: url.Values{"url": {snippetURL}, "format": {"yaml"}}, wantCode: http.StatusNotImplemented},
+		{name: "No URL", query: url.Values{}, wantCode: http.StatusBadRequest},
+		{name: "Missing snippet", query: url.Values{"url": {ts.URL + "/snippet/view/2"}}, wantCode: http.StatusNotFound},
+		{name: "Not a snippet", query: url.Values{"url": {ts.URL + "/about"}}, wantCode: http.StatusNotFound},
+		{name: "Another site", query: url.Values{"url": {"https://example.com/snippet/view/1"}}, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, "/oembed?"+tt.query.Encode())
+			assert.Equal(t, code, tt.wantCode)
+			if code != http.StatusOK {
+				return
+			}
+			var res oEmbedResponse
+			var err error
+			if tt.query.Get("format") == "xml" {
+				assert.Equal(t, header.Get("Content-Type"), "text/xml; charset=utf-8")
+				err = xml.Unmarshal([]byte(body), &res)
+			} else {
+				assert.Equal(t, header.Get("Content-Type"), "application/json")
+				err = json.Unmarshal([]byte(body), &res)
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, res.Type, "rich")
+			assert.Equal(t, res.Version, "1.0")
+			assert.Equal(t, res.Title, "An old silent pond")
+			assert.Equal(t, res.AuthorName, "Alice")
+			assert.Equal(t, res.Width, tt.wantWidth)
+			assert.Equal(t, res.Height, tt.wantHeight)
+			assert.StringContains(t, res.HTML, `<iframe src="`+ts.URL+`/embed/1"`)
+		})
+	}
+}
+
+func TestSnippetEmbed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/embed/1")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "An old silent pond...")
+	assert.StringContains(t, body, "/static/css/embed.css")
+	// The minimal layout has no navigation.
+	if strings.Contains(body, "<nav>") {
+		t.Errorf("want no navigation in the embed layout")
+	}
+	assert.StringContains(t, header.Get("Content-Security-Policy"), "frame-ancestors 'self' https://wiki.example.com")
+	assert.Equal(t, header.Get("X-Frame-Options"), "")
+	assert.Equal(t, header.Get("Set-Cookie"), "")
+
+	code, _, _ = ts.get(t, "/embed/2")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// Every other page still refuses to be framed.
+	_, header, _ = ts.get(t, "/snippet/view/1")
+	assert.StringContains(t, header.Get("Content-Security-Policy"), "frame-ancestors 'none'")
+	assert.Equal(t, header.Get("X-Frame-Options"), "deny")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// accountExport is everything a user owns, in the shape that we hand back to
+// them before they delete their account.
+type accountExport struct {
+	Exported time.Time       `json:"exported"`
+	Profile  exportProfile   `json:"profile"`
+	Snippets []exportSnippet `json:"snippets"`
+}
+
+type exportProfile struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	Created time.Time `json:"created"`
+	Active  bool      `json:"active"`
+}
+
+type exportSnippet struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// buildAccountExport collects the data owned by a user from the models.
+func (app *application) buildAccountExport(userID int) (*accountExport, error) {
+	user, err := app.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := app.snippets.ForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	export := &accountExport{
+		Exported: time.Now().UTC(),
+		Profile: exportProfile{
+			ID:      user.ID,
+			Name:    user.Name,
+			Email:   user.Email,
+			Created: user.Created,
+			Active:  user.Active,
+		},
+		Snippets: make([]exportSnippet, 0, len(snippets)),
+	}
+	for _, s := range snippets {
+		export.Snippets = append(export.Snippets, exportSnippet{
+			ID:      s.ID,
+			Title:   s.Title,
+			Content: s.Content,
+			Created: s.Created,
+			Expires: s.Expires,
+		})
+	}
+	return export, nil
+}
+
+// writeJSON writes the export as indented JSON.
+func (e *accountExport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// writeZip writes a ZIP archive containing the full export as export.json,
+// plus every snippet as its own plain text file so they are easy to reuse.
+func (e *accountExport) writeZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("export.json")
+	if err != nil {
+		return err
+	}
+	err = e.writeJSON(f)
+	if err != nil {
+		return err
+	}
+	for _, s := range e.Snippets {
+		f, err := zw.Create(fmt.Sprintf("snippets/%d.txt", s.ID))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, s.Content)
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// feedCacheTTL is how long a generated feed is served before the snippets are
+// loaded again. Feed readers poll often, so within the TTL they are answered
+// from memory, and usually with a 304.
+const feedCacheTTL = time.Minute
+
+// feed is what the Atom and RSS feeds are generated from. Link is the page
+// the feed is about and Self the feed's own URL, both relative to the site.
+type feed struct {
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	Author      string
+	Snippets    []*models.Snippet
+}
+
+// updated is the time of the newest entry. Snippets have no modification
+// time of their own, so it is the creation time.
+func (f *feed) updated() time.Time {
+	var updated time.Time
+	for _, s := range f.Snippets {
+		if s.Created.After(updated) {
+			updated = s.Created
+		}
+	}
+	return updated.UTC()
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Summary string      `xml:"subtitle"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string   `xml:"title"`
+	ID        string   `xml:"id"`
+	Link      atomLink `xml:"link"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+	Content   atomText `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// atom renders the feed as Atom 1.0, with absolute URLs under base.
+func (f *feed) atom(base string) ([]byte, error) {
+	out := atomFeed{
+		Title:   f.Title,
+		Summary: f.Description,
+		ID:      base + f.Self,
+		Updated: f.updated().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: base + f.Self, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Author:  atomPerson{Name: f.Author},
+		Entries: []atomEntry{},
+	}
+	for _, s := range f.Snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", base, s.ID)
+		created := s.Created.UTC().Format(time.RFC3339)
+		out.Entries = append(out.Entries, atomEntry{
+			Title:     s.Title,
+			ID:        link,
+			Link:      atomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Published: created,
+			Updated:   created,
+			Content:   atomText{Type: "text", Body: s.Content},
+		})
+	}
+	return encodeFeed(out)
+}
+
+// rss renders the feed as RSS 2.0, with absolute URLs under base.
+func (f *feed) rss(base string) ([]byte, error) {
+	out := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        base + f.Link,
+			Description: f.Description,
+			Items:       []rssItem{},
+		},
+	}
+	if len(f.Snippets) > 0 {
+		out.Channel.LastBuildDate = f.updated().Format(time.RFC1123Z)
+	}
+	for _, s := range f.Snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", base, s.ID)
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       s.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     s.Created.UTC().Format(time.RFC1123Z),
+			Description: s.Content,
+		})
+	}
+	return encodeFeed(out)
+}
+
+func encodeFeed(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// cachedFeed is a generated feed with its validators. Modified is when the
+// content last changed, as far as this instance of the application knows.
+type cachedFeed struct {
+	body     []byte
+	etag     string
+	modified time.Time
+	expires  time.Time
+}
+
+// feedCache keeps generated feeds in memory for a while.
+type feedCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cachedFeed
+}
+
+func newFeedCache(ttl time.Duration) *feedCache {
+	return &feedCache{ttl: ttl, entries: make(map[string]*cachedFeed)}
+}
+
+// get returns the feed stored under key, unless it has expired.
+func (c *feedCache) get(key string, now time.Time) (*cachedFeed, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// put stores a freshly generated feed. If it is the same as the expired copy,
+// the old modification time is kept, so that conditional requests from
+// readers which already have it still get a 304. Expired feeds are dropped
+// at the same time, so the cache only grows with the number of feeds that are
+// actually being read.
+func (c *feedCache) put(key string, body []byte, now time.Time) *cachedFeed {
+	sum := sha256.Sum256(body)
+	entry := &cachedFeed{
+		body:     body,
+		etag:     `"` + hex.EncodeToString(sum[:16]) + `"`,
+		modified: now.UTC().Truncate(time.Second),
+		expires:  now.Add(c.ttl),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok && old.etag == entry.etag {
+		entry.modified = old.modified
+	}
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = entry
+	return entry
+}
+
+// siteURL returns the scheme and host the request was made to, which feeds
+// use to make their links absolute.
+func siteURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// serveFeed sends a feed in the given format ("atom" or "rss"), generating it
+// with load if there is no fresh copy in the cache. Load doesn't need to fill
+// in Self, which is always the requested path. http.ServeContent takes
+// care of If-None-Match and If-Modified-Since.
+func (app *application) serveFeed(w http.ResponseWriter, r *http.Request, format string, load func(*http.Request) (*feed, error)) {
+	base := siteURL(r)
+	// The links depend on the Host header, so it is part of the key; that
+	// way nobody can get their own host name into everybody else's feed.
+	key := base + r.URL.Path
+	now := time.Now()
+	entry, ok := app.feeds.get(key, now)
+	if !ok {
+		f, err := load(r)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+		f.Self = r.URL.Path
+		var body []byte
+		if format == "atom" {
+			body, err = f.atom(base)
+		} else {
+			body, err = f.rss(base)
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		entry = app.feeds.put(key, body, now)
+	}
+	if format == "atom" {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	}
+	w.Header().Set("ETag", entry.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedCacheTTL.Seconds())))
+	http.ServeContent(w, r, "", entry.modified, bytes.NewReader(entry.body))
+}
+
+// latestFeed is the feed version of the home page.
+func (app *application) latestFeed(r *http.Request) (*feed, error) {
+	snippets, err := app.snippets.Latest()
+	if err != nil {
+		return nil, err
+	}
+	return &feed{
+		Title:       "Snippetbox",
+		Description: "The latest snippets on Snippetbox",
+		Link:        "/",
+		Author:      "Snippetbox",
+		Snippets:    snippets,
+	}, nil
+}
+
+// userFeed is the feed of the latest snippets of the user in the :id route
+// parameter. Deactivated users don't have one.
+func (app *application) userFeed(r *http.Request) (*feed, error) {
+	id := readIDParam(r)
+	if id == 0 {
+		return nil, models.ErrNoRecord
+	}
+	user, err := app.users.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Active {
+		return nil, models.ErrNoRecord
+	}
+	snippets, err := app.snippets.LatestForUser(id)
+	if err != nil {
+		return nil, err
+	}
+	return &feed{
+		Title:       fmt.Sprintf("%s on Snippetbox", user.Name),
+		Description: fmt.Sprintf("The latest snippets by %s", user.Name),
+		Link:        "/",
+		Author:      user.Name,
+		Snippets:    snippets,
+	}, nil
+}
+
+func (app *application) feedAtom(w http.ResponseWriter, r *http.Request) {
+	app.serveFeed(w, r, "atom", app.latestFeed)
+}
+
+func (app *application) feedRSS(w http.ResponseWriter, r *http.Request) {
+	app.serveFeed(w, r, "rss", app.latestFeed)
+}
+
+func (app *application) userFeedAtom(w http.ResponseWriter, r *http.Request) {
+	app.serveFeed(w, r, "atom", app.userFeed)
+}
+
+func (app *application) userFeedRSS(w http.ResponseWriter, r *http.Request) {
+	app.serveFeed(w, r, "rss", app.userFeed)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/models"
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Run "go test ./cmd/web -run TestFeedGolden -update" after changing the feed
+// format on purpose, and check the diff of the golden files.
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestFeedGolden(t *testing.T) {
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	f := &feed{
+		Title:       "Snippetbox",
+		Description: "The latest snippets on Snippetbox",
+		Link:        "/",
+		Self:        "/feed.atom",
+		Author:      "Snippetbox",
+		Snippets: []*models.Snippet{
+			{ID: 2, UserID: 1, Title: "First autumn morning", Content: "the mirror I stare into\nshows my father's face", Created: created.Add(time.Hour)},
+			{ID: 1, UserID: 1, Title: "An old silent pond", Content: "A frog jumps into the pond, <splash!> & silence again.", Created: created},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		golden string
+		encode func(string) ([]byte, error)
+		check  func(t *testing.T, b []byte)
+	}{
+		{
+			name:   "Atom",
+			golden: "feed.atom.golden",
+			encode: f.atom,
+			check: func(t *testing.T, b []byte) {
+				var got atomFeed
+				err := xml.Unmarshal(b, &got)
+				assert.NilError(t, err)
+				assert.Equal(t, got.XMLName.Space, "http://www.w3.org/2005/Atom")
+				assert.Equal(t, got.ID, "https://snippetbox.test/feed.atom")
+				assert.Equal(t, got.Updated, "2024-03-17T11:15:00Z")
+				assert.Equal(t, len(got.Entries), 2)
+				assert.Equal(t, got.Entries[1].Link.Href, "https://snippetbox.test/snippet/view/1")
+				assert.Equal(t, got.Entries[1].Content.Body, f.Snippets[1].Content)
+			},
+		},
+		{
+			name:   "RSS",
+			golden: "feed.rss.golden",
+			encode: f.rss,
+			check: func(t *testing.T, b []byte) {
+				var got rssFeed
+				err := xml.Unmarshal(b, &got)
+				assert.NilError(t, err)
+				assert.Equal(t, got.Version, "2.0")
+				assert.Equal(t, got.Channel.Link, "https://snippetbox.test/")
+				assert.Equal(t, len(got.Channel.Items), 2)
+				assert.Equal(t, got.Channel.Items[0].GUID.Value, "https://snippetbox.test/snippet/view/2")
+				assert.Equal(t, got.Channel.Items[1].PubDate, "Sun, 17 Mar 2024 10:15:00 +0000")
+				assert.Equal(t, got.Channel.Items[1].Description, f.Snippets[1].Content)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.encode("https://snippetbox.test")
+			assert.NilError(t, err)
+			tt.check(t, b)
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				err = os.WriteFile(golden, b, 0644)
+				assert.NilError(t, err)
+			}
+			want, err := os.ReadFile(golden)
+			assert.NilError(t, err)
+			if !bytes.Equal(b, want) {
+				t.Errorf("%s doesn't match; got:\n%s", golden, b)
+			}
+		})
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{name: "Latest Atom", urlPath: "/feed.atom", wantCode: http.StatusOK, wantContentType: "application/atom+xml; charset=utf-8", wantBody: "An old silent pond"},
+		{name: "Latest RSS", urlPath: "/feed.rss", wantCode: http.StatusOK, wantContentType: "application/rss+xml; charset=utf-8", wantBody: "An old silent pond"},
+		{name: "User Atom", urlPath: "/users/1/feed.atom", wantCode: http.StatusOK, wantContentType: "application/atom+xml; charset=utf-8", wantBody: "<name>Alice</name>"},
+		{name: "User RSS", urlPath: "/users/1/feed.rss", wantCode: http.StatusOK, wantContentType: "application/rss+xml; charset=utf-8", wantBody: "The latest snippets by Alice"},
+		{name: "User without snippets", urlPath: "/users/4/feed.atom", wantCode: http.StatusOK, wantContentType: "application/atom+xml; charset=utf-8", wantBody: "<name>Adam</name>"},
+		{name: "Inactive user", urlPath: "/users/2/feed.atom", wantCode: http.StatusNotFound},
+		{name: "Missing user", urlPath: "/users/99/feed.rss", wantCode: http.StatusNotFound},
+		{name: "Invalid user ID", urlPath: "/users/foo/feed.rss", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, header.Get("Content-Type"), tt.wantContentType)
+			assert.StringContains(t, body, tt.wantBody)
+			// Feeds are public, so they mustn't start a session.
+			assert.Equal(t, header.Get("Set-Cookie"), "")
+		})
+	}
+}
+
+func TestFeedConditionalRequests(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, header, _ := ts.get(t, "/feed.atom")
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("want ETag and Last-Modified; got %q and %q", etag, lastModified)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{name: "Matching ETag", header: "If-None-Match", value: etag, wantCode: http.StatusNotModified},
+		{name: "Stale ETag", header: "If-None-Match", value: `"stale"`, wantCode: http.StatusOK},
+		{name: "Not modified since", header: "If-Modified-Since", value: lastModified, wantCode: http.StatusNotModified},
+		{name: "Modified since", header: "If-Modified-Since", value: "Mon, 01 Jan 2001 00:00:00 GMT", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/feed.atom", nil)
+			assert.NilError(t, err)
+			req.Header.Set(tt.header, tt.value)
+			rs, err := ts.Client().Do(req)
+			assert.NilError(t, err)
+			rs.Body.Close()
+			assert.Equal(t, rs.StatusCode, tt.wantCode)
+			assert.Equal(t, rs.Header.Get("ETag"), etag)
+		})
+	}
+}
+
+func TestFeedCache(t *testing.T) {
+	c := newFeedCache(time.Minute)
+	start := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	first := c.put("/feed.atom", []byte("<feed/>"), start)
+	got, ok := c.get("/feed.atom", start.Add(30*time.Second))
+	assert.Equal(t, ok, true)
+	assert.Equal(t, got, first)
+	_, ok = c.get("/feed.atom", start.Add(2*time.Minute))
+	assert.Equal(t, ok, false)
+
+	// The same content generated again keeps its modification time...
+	same := c.put("/feed.atom", []byte("<feed/>"), start.Add(2*time.Minute))
+	assert.Equal(t, same.etag, first.etag)
+	assert.Equal(t, same.modified, start)
+	// ...but new content doesn't.
+	changed := c.put("/feed.atom", []byte("<feed><entry/></feed>"), start.Add(4*time.Minute))
+	if changed.etag == first.etag {
+		t.Errorf("want a new ETag for new content")
+	}
+	assert.Equal(t, changed.modified, start.Add(4*time.Minute))
+}
@@ -3,10 +3,12 @@ package main
 import (
 	"GoWebPractice/internal/models"
 	"GoWebPractice/internal/validator"
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -17,18 +19,30 @@ func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// ready is the readiness check for load balancers. Unlike ping it starts
+// failing as soon as the server begins to shut down, so that they stop sending
+// it new requests while the ones in flight finish (see serve).
+func (app *application) ready(w http.ResponseWriter, r *http.Request) {
+	if app.draining.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
 	snippets, err := app.snippets.Latest()
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	// Call the newTemplateData() helper to get a templateData struct containing // the 'default' data (which for now is just the current year), and add the // snippets slice to it.
 	data := app.newTemplateData(r)
 	data.Snippets = snippets
-	// Pass the data to the render() helper as normal.
-	app.render(w, http.StatusOK, "home.tmpl", data)
+	// Pass the data to the respond() helper, which renders the page or sends
+	// the snippets as JSON depending on what the client asked for.
+	app.respond(w, r, http.StatusOK, "home.tmpl", data)
 }
 
 // Update our snippetCreateForm struct to include struct tags which tell the
@@ -37,9 +51,13 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 // input with the name "title" in the Title field. The struct tag `form:"-"`
 // tells the decoder to completely ignore a field during decoding.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title   string `form:"title"`
+	Content string `form:"content"`
+	Expires int    `form:"expires"`
+	// Snippets which look like they contain secrets are only published once
+	// the author has seen the warning and ticked ConfirmSecrets.
+	ConfirmSecrets      bool                      `form:"confirmSecrets"`
+	Secrets             []validator.SecretFinding `form:"-"`
 	validator.Validator `form:"-"`
 }
 
@@ -54,6 +72,22 @@ type userSignupForm struct {
 // Create a new userLoginForm struct.
 type userLoginForm struct {
 	Email               string `form:"email"`
+	Password            string `form:"password"`
+	RememberMe          bool   `form:"remember"`
+	validator.Validator `form:"-"`
+}
+
+type userReauthForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+type accountDeactivateForm struct {
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+type accountDeleteForm struct {
 	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
@@ -69,21 +103,22 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	params := httprouter.ParamsFromContext(r.Context())
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil || id < 1 {
-		app.notFound(w)
+		app.notFound(w, r)
 		return
 	}
 	snippet, err := app.snippets.Get(id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w)
+			app.notFound(w, r)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
-	app.render(w, http.StatusOK, "view.tmpl", data)
+	data.Form = snippetReportForm{}
+	app.respond(w, r, http.StatusOK, "view.tmpl", data)
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
@@ -93,13 +128,13 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	// 'initial' values for the form --- here we set the initial value for the
 	// snippet expiry to 365 days.
 	data.Form = snippetCreateForm{Expires: 365}
-	app.render(w, http.StatusOK, "create.tmpl", data)
+	app.render(w, r, http.StatusOK, "create.tmpl", data)
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// Declare a new empty instance of the snippetCreateForm struct.
@@ -110,46 +145,61 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	// If there is a problem, we return a 400 Bad Request response to the client.
 	err = app.formDecoder.Decode(&form, r.PostForm)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// Then validate and use the data as normal...
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	// Use the generic PermittedValue() function instead of the type-specific
-	// PermittedInt() function.
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.Secrets = app.validateSnippet(&form.Validator, form.Title, form.Content, form.Expires, form.ConfirmSecrets)
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "create.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	userID := app.authenticatedUser(r).ID
+	id, err := app.snippets.Insert(userID, form.Title, form.Content, form.Expires)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
 	// Use the Put() method to add a string value ("Snippet successfully
 	// created!") and the corresponding key ("flash") to the session data.
+	app.audit(r, "snippet_create", "snippet_id=%d", id)
+	app.snippetEvent(r.Context(), userID, models.EventSnippetCreated, id)
 	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
 
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// validateSnippet runs the checks shared by the HTML form and the JSON API,
+// and returns the lines which look like secrets. A snippet with secrets is
+// only valid once the author has confirmed that they want to publish it.
+func (app *application) validateSnippet(v *validator.Validator, title, content string, expires int, confirmSecrets bool) []validator.SecretFinding {
+	v.CheckField(validator.NotBlank(title), "title", "This field cannot be blank")
+	v.CheckField(validator.MaxChars(title, 100), "title", "This field cannot be more than 100 characters long")
+	v.CheckField(validator.NotBlank(content), "content", "This field cannot be blank")
+	// Use the generic PermittedValue() function instead of the type-specific
+	// PermittedInt() function.
+	v.CheckField(validator.PermittedValue(expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	secrets := app.secretScanner.Scan(content)
+	if len(secrets) > 0 && !confirmSecrets {
+		v.AddNonFieldError("This snippet looks like it contains secrets. Remove them, or confirm that you want to publish it anyway.")
+	}
+	return secrets
+}
+
 func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userSignupForm{}
-	app.render(w, http.StatusOK, "signup.tmpl", data)
+	app.render(w, r, http.StatusOK, "signup.tmpl", data)
 }
 func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) { // Declare an zero-valued instance of our userSignupForm struct.
 	var form userSignupForm
 	// Parse the form data into the userSignupForm struct.
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// Validate the form contents using our helper functions.
@@ -162,7 +212,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		return
 	}
 	// Try to create a new user record in the database. If the email already
@@ -173,12 +223,13 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 			form.AddFieldError("email", "Email address is already in use")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "signup.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
+	app.audit(r, "signup", "email=%q", form.Email)
 	// Otherwise add a confirmation flash message to the session confirming that
 	// their signup worked.
 	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
@@ -190,13 +241,13 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
-	app.render(w, http.StatusOK, "login.tmpl", data)
+	app.render(w, r, http.StatusOK, "login.tmpl", data)
 }
 func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) { // Decode the form data into the userLoginForm struct.
 	var form userLoginForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// Do some validation checks on the form. We check that both email and
@@ -208,7 +259,24 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		return
+	}
+	// Refuse to check the password at all while either the account or the
+	// client IP is locked out. The message deliberately doesn't say which of
+	// the two limits was hit.
+	accountKey, ipKey := app.loginKeys(r, form.Email)
+	throttled, err := app.loginThrottled(accountKey, ipKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if throttled {
+		app.audit(r, "login_throttled", "email=%q", form.Email)
+		form.AddNonFieldError("Too many failed login attempts. Please try again later.")
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusTooManyRequests, "login.tmpl", data)
 		return
 	}
 	// Check whether the credentials are valid. If they're not, add a generic
@@ -216,27 +284,66 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 	id, err := app.users.Authenticate(form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
+			err = app.loginFailed(accountKey, ipKey)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			app.audit(r, "login_failure", "email=%q", form.Email)
 			form.AddNonFieldError("Email or password is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "login.tmpl", data)
+			app.render(w, r, http.StatusUnprocessableEntity, "login.tmpl", data)
+		} else if errors.Is(err, models.ErrInactiveAccount) {
+			app.audit(r, "login_inactive", "email=%q", form.Email)
+			form.AddNonFieldError("This account has been deactivated")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusForbidden, "login.tmpl", data)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
+	// A successful login clears the account's failure count. The IP counter is
+	// left alone, otherwise one valid account would be enough to keep guessing
+	// the passwords of others from the same address.
+	err = app.accountLimiter.Reset(accountKey)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.auditAs(r, id, "login_success", "")
 	// Use the RenewToken() method on the current session to change the session
 	// ID. It's good practice to generate a new session ID when the
 	// authentication state or privilege levels changes for the user (e.g. login
 	// and logout operations).
 	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+	// Sessions normally end after the session manager's lifetime and use a
+	// cookie which the browser forgets when it is closed. "Remember me" makes
+	// the cookie persistent and extends the session to app.rememberMeLifetime.
+	expires := app.sessionManager.Deadline(r.Context()).UTC()
+	if form.RememberMe {
+		expires = time.Now().Add(app.rememberMeLifetime).UTC()
+		app.sessionManager.RememberMe(r.Context(), true)
+		app.sessionManager.SetDeadline(r.Context(), expires)
+	}
+	// Record the new session so that it shows up (and can be revoked) on the
+	// account sessions page until it expires.
+	sessionID, err := app.sessions.Insert(id, app.sessionManager.Token(r.Context()), r.UserAgent(), app.clientIP(r), expires)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 	// Add the ID of the current user to the session, so that they are now
 	// 'logged in'.
 	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	app.sessionManager.Put(r.Context(), "sessionID", sessionID)
+	app.sessionManager.Put(r.Context(), "authenticatedAt", time.Now().Unix())
 
 	// Use the PopString method to retrieve and remove a value from the session
 	// data in one step. If no matching key exists this will return the empty
@@ -251,16 +358,18 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
-	// Use the RenewToken() method on the current session to change the session
-	// ID again.
-	err := app.sessionManager.RenewToken(r.Context())
+	userID := app.authenticatedUser(r).ID
+	app.audit(r, "logout", "")
+	err := app.sessions.Delete(app.sessionManager.GetString(r.Context(), "sessionID"), userID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.logout(r)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
-	// Remove the authenticatedUserID from the session data so that the user is
-	// 'logged out'.
-	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
 	// Add a flash message to the session to confirm to the user that they've been
 	// logged out.
 	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
@@ -270,36 +379,103 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) about(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
-	app.render(w, http.StatusOK, "about.tmpl", data)
+	app.render(w, r, http.StatusOK, "about.tmpl", data)
 }
 
 func (app *application) accountView(w http.ResponseWriter, r *http.Request) {
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+	userID := app.authenticatedUser(r).ID
 	user, err := app.users.Get(userID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 	data := app.newTemplateData(r)
 	data.User = user
-	app.render(w, http.StatusOK, "account.tmpl", data)
+	data.Form = accountDeactivateForm{}
+	app.render(w, r, http.StatusOK, "account.tmpl", data)
+}
+
+// accountDeactivatePost lets users deactivate their own account. They are
+// logged out of every session straight away, as when they delete it.
+func (app *application) accountDeactivatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeactivateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	userID := app.authenticatedUser(r).ID
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		err = app.checkPassword(r, func(id int) error { return app.users.CheckPassword(id, form.Password) })
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+		} else if errors.Is(err, errTooManyAttempts) {
+			status = http.StatusTooManyRequests
+			form.AddFieldError("password", "Too many failed attempts. Please try again later.")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		user, err := app.users.Get(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data := app.newTemplateData(r)
+		data.User = user
+		data.Form = form
+		app.render(w, r, status, "account.tmpl", data)
+		return
+	}
+	err = app.users.SetActive(userID, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "account_deactivate", "")
+	tokens, err := app.sessions.Tokens(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.destroySessions(tokens)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.sessions.DeleteOthers(userID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.logout(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deactivated.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (app *application) accountPasswordUpdate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = accountPasswordUpdateForm{}
-	app.render(w, http.StatusOK, "password.tmpl", data)
+	app.render(w, r, http.StatusOK, "password.tmpl", data)
 }
 
 func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http.Request) {
 	var form accountPasswordUpdateForm
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	form.CheckField(validator.NotBlank(form.CurrentPassword), "currentPassword", "This field cannot be blank")
@@ -310,22 +486,237 @@ func (app *application) accountPasswordUpdatePost(w http.ResponseWriter, r *http
 	if !form.Valid() {
 		data := app.newTemplateData(r)
 		data.Form = form
-		app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
+		app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl", data)
 		return
 	}
-	userID := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
-	err = app.users.PasswordUpdate(userID, form.CurrentPassword, form.NewPassword)
+	userID := app.authenticatedUser(r).ID
+	err = app.checkPassword(r, func(id int) error { return app.users.PasswordUpdate(id, form.CurrentPassword, form.NewPassword) })
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
 			form.AddFieldError("currentPassword", "Current password is incorrect")
 			data := app.newTemplateData(r)
 			data.Form = form
-			app.render(w, http.StatusUnprocessableEntity, "password.tmpl", data)
-		} else if err != nil {
-			app.serverError(w, err)
+			app.render(w, r, http.StatusUnprocessableEntity, "password.tmpl", data)
+		} else if errors.Is(err, errTooManyAttempts) {
+			form.AddFieldError("currentPassword", "Too many failed attempts. Please try again later.")
+			data := app.newTemplateData(r)
+			data.Form = form
+			app.render(w, r, http.StatusTooManyRequests, "password.tmpl", data)
+		} else {
+			app.serverError(w, r, err)
 		}
 		return
 	}
-	app.sessionManager.Put(r.Context(), "flash", "Your password has been updated!")
+	// API tokens don't expire with the session, so a token made by whoever
+	// knew the old password would otherwise outlive the change.
+	n, err := app.tokens.DeleteAll(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "password_change", "tokens_revoked=%d", n)
+	if n > 0 {
+		app.sessionManager.Put(r.Context(), "flash", "Your password has been updated, and your API tokens have been revoked.")
+	} else {
+		app.sessionManager.Put(r.Context(), "flash", "Your password has been updated!")
+	}
 	http.Redirect(w, r, "/account/view", http.StatusSeeOther)
 }
+
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountDeleteForm{}
+	app.render(w, r, http.StatusOK, "delete.tmpl", data)
+}
+
+// accountExport sends the user everything they own, either as a single JSON
+// document or as a ZIP archive, depending on the format query parameter.
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if !validator.PermittedValue(format, "json", "zip") {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	userID := app.authenticatedUser(r).ID
+	export, err := app.buildAccountExport(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	// Build the whole file in memory first, so that an error half way
+	// through still results in a proper error response.
+	buf := new(bytes.Buffer)
+	if format == "zip" {
+		err = export.writeZip(buf)
+		w.Header().Set("Content-Type", "application/zip")
+	} else {
+		err = export.writeJSON(buf)
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "account_export", "format=%s", format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="snippetbox-export.%s"`, format))
+	buf.WriteTo(w)
+}
+
+// accountDeletePost permanently deletes the user's account after checking
+// their password. What happens to their snippets depends on the configured
+// deletion policy.
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	var form accountDeleteForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	userID := app.authenticatedUser(r).ID
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		err = app.checkPassword(r, func(id int) error { return app.users.CheckPassword(id, form.Password) })
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			form.AddFieldError("password", "Password is incorrect")
+		} else if errors.Is(err, errTooManyAttempts) {
+			status = http.StatusTooManyRequests
+			form.AddFieldError("password", "Too many failed attempts. Please try again later.")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, status, "delete.tmpl", data)
+		return
+	}
+	// Deleting the user deletes the records of their sessions, so look up
+	// the sessions' tokens first.
+	tokens, err := app.sessions.Tokens(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.users.Delete(userID, app.deletionPolicy)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "account_delete", "policy=%s", app.deletionPolicy)
+	// Log the user out of every other device, then log out this session.
+	err = app.destroySessions(tokens)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.logout(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUser(r).ID
+	sessions, err := app.sessions.ForUser(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.CurrentSessionID = app.sessionManager.GetString(r.Context(), "sessionID")
+	app.render(w, r, http.StatusOK, "sessions.tmpl", data)
+}
+
+// accountSessionRevokePost revokes a single session. The session is logged out
+// by the authenticate middleware on its next request.
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	userID := app.authenticatedUser(r).ID
+	sessionID := r.PostForm.Get("id")
+	err = app.sessions.Delete(sessionID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "session_revoke", "")
+	app.sessionManager.Put(r.Context(), "flash", "The session has been logged out.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// accountSessionsRevokeOthersPost logs the user out everywhere except for the
+// session making the request.
+func (app *application) accountSessionsRevokeOthersPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUser(r).ID
+	currentID := app.sessionManager.GetString(r.Context(), "sessionID")
+	err := app.sessions.DeleteOthers(userID, currentID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "session_revoke_others", "")
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out everywhere else.")
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// userReauth asks a logged-in user for their password again before letting
+// them continue with a sensitive action. See requireRecentAuth.
+func (app *application) userReauth(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = userReauthForm{}
+	app.render(w, r, http.StatusOK, "reauth.tmpl", data)
+}
+
+func (app *application) userReauthPost(w http.ResponseWriter, r *http.Request) {
+	var form userReauthForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	status := http.StatusUnprocessableEntity
+	if form.Valid() {
+		err = app.checkPassword(r, func(id int) error { return app.users.CheckPassword(id, form.Password) })
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.audit(r, "reauth_failure", "")
+			form.AddFieldError("password", "Password is incorrect")
+		} else if errors.Is(err, errTooManyAttempts) {
+			app.audit(r, "reauth_throttled", "")
+			status = http.StatusTooManyRequests
+			form.AddFieldError("password", "Too many failed attempts. Please try again later.")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, status, "reauth.tmpl", data)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "authenticatedAt", time.Now().Unix())
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterReauth")
+	if path == "" {
+		path = "/account/view"
+	}
+	http.Redirect(w, r, path, http.StatusSeeOther)
+}
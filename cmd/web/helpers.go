@@ -1,48 +1,163 @@
 package main
 
 import (
+	"GoWebPractice/internal/models"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/netip"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form"
 	"github.com/justinas/nosurf"
 )
 
-// The serverError helper writes an error message and stack trace to the errorLog,
-// then sends a generic 500 Internal Server Error response to the user.
-func (app *application) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorLog.Output(2, trace)
+// The serverError helper logs the error, with the stack trace as its "trace"
+// attribute, then sends a generic 500 Internal Server Error response to the
+// user, as JSON if that's what they asked for. The response includes the
+// request ID, so that the user can quote it and we can find the log lines.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	trace := string(debug.Stack())
+	app.logError(r.Context(), err, slog.String("trace", trace))
+	message := http.StatusText(http.StatusInternalServerError)
 	if app.debug {
-		http.Error(w, trace, http.StatusInternalServerError)
+		message = fmt.Sprintf("%s\n%s", err.Error(), trace)
+	}
+	if app.negotiate(w, r) {
+		app.writeJSON(w, http.StatusInternalServerError, app.serverErrorBody(r, message), nil)
 		return
 	}
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if info := requestInfoFrom(r.Context()); info != nil {
+		message = fmt.Sprintf("%s\n\nRequest ID: %s", message, info.id)
+	}
+	http.Error(w, message, http.StatusInternalServerError)
 }
 
 // The clientError helper sends a specific status code and corresponding description
 // to the user. We'll use this later in the book to send responses like 400 "Bad
 // Request" when there's a problem with the request that the user sent.
-func (app *application) clientError(w http.ResponseWriter, status int) {
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	if app.negotiate(w, r) {
+		app.apiError(w, status, http.StatusText(status))
+		return
+	}
 	http.Error(w, http.StatusText(status), status)
 }
 
 // For consistency, we'll also implement a notFound helper. This is simply a
 // convenience wrapper around clientError which sends a 404 Not Found response to
 // the user.
-func (app *application) notFound(w http.ResponseWriter) {
-	app.clientError(w, http.StatusNotFound)
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.clientError(w, r, http.StatusNotFound)
+}
+
+// negotiate reports whether the response to r should be JSON rather than HTML,
+// and records in the Vary header that the answer depends on Accept, so that
+// caches keep the two apart.
+func (app *application) negotiate(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Accept")
+	return wantsJSON(r)
+}
+
+// wantsJSON reports whether the Accept header prefers application/json to
+// text/html. Browsers list text/html explicitly, so they still get HTML even
+// though they accept */* as well, and so does a request with no Accept header.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, "text/html")
+}
+
+// acceptQuality returns the q value an Accept header gives to a media type,
+// taken from the most specific range which matches it. An empty header
+// accepts everything.
+func acceptQuality(accept, mediaType string) float64 {
+	if accept == "" {
+		return 1
+	}
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		var s int
+		switch mt {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				q = 0
+			}
+		}
+		quality, specificity = q, s
+	}
+	return quality
+}
+
+// respond is render for pages which are also available as JSON. The handler
+// fills in the template data once; JSON clients get the parts of it listed in
+// jsonEnvelope, everybody else gets the page.
+func (app *application) respond(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
+	if app.negotiate(w, r) {
+		app.writeJSON(w, status, data.jsonEnvelope(), nil)
+		return
+	}
+	app.render(w, r, status, page, data)
+}
+
+// jsonEnvelope picks the parts of the template data which make sense outside
+// a web page, in the same shape as the JSON API. Things which belong to the
+// browser session, like the flash message or the CSRF token, are left out.
+func (td *templateData) jsonEnvelope() envelope {
+	env := envelope{}
+	if td.Snippet != nil {
+		env["snippet"] = newAPISnippet(td.Snippet)
+	}
+	if td.Snippets != nil {
+		list := make([]apiSnippet, 0, len(td.Snippets))
+		for _, s := range td.Snippets {
+			list = append(list, newAPISnippet(s))
+		}
+		env["snippets"] = list
+	}
+	return env
+}
+
+// render writes a page with the base layout. That is where the flash message is
+// shown, so it is only taken out of the session here: a JSON response or an
+// embedded snippet leaves it for the next page the browser gets.
+func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data *templateData) {
+	data.Flash = app.sessionManager.PopString(r.Context(), "flash")
+	app.renderLayout(w, r, status, page, "base", data)
 }
 
-func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+// renderLayout is render with another layout than base.tmpl, such as the
+// minimal one of embedded snippets.
+func (app *application) renderLayout(w http.ResponseWriter, r *http.Request, status int, page, layout string, data *templateData) {
 	ts, ok := app.templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	// Initialize a new buffer.
@@ -50,9 +165,9 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 	// Write the template to the buffer, instead of straight to the
 	// http.ResponseWriter. If there's an error, call our serverError() helper
 	// and then return.
-	err := ts.ExecuteTemplate(buf, "base", data)
+	err := ts.ExecuteTemplate(buf, layout, data)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 	// If the template is written to the buffer without any errors, we are safe
@@ -69,11 +184,10 @@ func (app *application) render(w http.ResponseWriter, status int, page string, d
 func (app *application) newTemplateData(r *http.Request) *templateData {
 	return &templateData{
 		CurrentYear: time.Now().Year(),
-		// Add the flash message to the template data, if one exists.
-		Flash: app.sessionManager.PopString(r.Context(), "flash"),
 		// Add the authentication status to the template data.
-		IsAuthenticated: app.isAuthenticated(r),
-		CSRFToken:       nosurf.Token(r), // Add the CSRF token.
+		IsAuthenticated:   app.isAuthenticated(r),
+		AuthenticatedUser: app.authenticatedUser(r),
+		CSRFToken:         nosurf.Token(r), // Add the CSRF token.
 	}
 }
 
@@ -106,9 +220,172 @@ func (app *application) decodePostForm(r *http.Request, dst any) error {
 
 // 不用再去檢查 session manager，而是檢查 context
 func (app *application) isAuthenticated(r *http.Request) bool {
-	isAuthenticated, ok := r.Context().Value(isAuthenticatedContextKey).(bool)
+	return app.authenticatedUser(r) != nil
+}
+
+// authenticatedUser returns the user making the request, as loaded by the
+// authenticate middleware, or nil if the request isn't authenticated.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
 	if !ok {
-		return false
+		return nil
+	}
+	return user
+}
+
+// contextSetAuthenticatedUser returns a copy of the request with the user
+// added to its context.
+func contextSetAuthenticatedUser(r *http.Request, user *models.User) *http.Request {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.userID = user.ID
+	}
+	ctx := context.WithValue(r.Context(), authenticatedUserContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// clientIP returns the IP address of the client which made the request. It is
+// used for rate limiting, and anybody can set X-Forwarded-For, so the header is
+// only believed as far as it was written by the trusted proxies: it is read
+// from the right, skipping the proxies, and the first other address is the
+// client's. Without any trusted proxies, the client is simply the peer.
+func (app *application) clientIP(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := addrPort.Addr().Unmap()
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && app.trustedProxy(ip); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// The proxy doesn't know who its client was either.
+			break
+		}
+		ip = hop.Unmap()
+	}
+	return ip.String()
+}
+
+// trustedProxy reports whether ip belongs to one of the trusted proxies.
+func (app *application) trustedProxy(ip netip.Addr) bool {
+	for _, proxy := range app.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
 	}
-	return isAuthenticated
+	return false
+}
+
+// audit records a security-relevant event in the audit log, with the
+// logged-in user (if any) as the actor.
+func (app *application) audit(r *http.Request, event string, format string, args ...any) {
+	actorID := 0
+	if user := app.authenticatedUser(r); user != nil {
+		actorID = user.ID
+	}
+	app.auditAs(r, actorID, event, format, args...)
+}
+
+// auditAs is like audit, but for events where the actor isn't on the request
+// context yet, such as a successful login. A failure to write the entry is
+// logged rather than failing the request.
+func (app *application) auditAs(r *http.Request, actorID int, event string, format string, args ...any) {
+	entry := &models.AuditEntry{
+		ActorID:   actorID,
+		Event:     event,
+		Details:   fmt.Sprintf(format, args...),
+		IP:        app.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	err := app.auditLog.Insert(entry)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), "writing audit entry", "error", err, "event", event, "actor_id", actorID, "details", entry.Details)
+	}
+}
+
+// loginKeys returns the keys under which login attempts with the given email
+// address are counted by the account and IP limiters.
+func (app *application) loginKeys(r *http.Request, email string) (accountKey, ipKey string) {
+	return "account:" + strings.ToLower(email), "ip:" + app.clientIP(r)
+}
+
+// loginThrottled checks the account and IP limiters and reports whether either
+// of them currently refuses login attempts.
+func (app *application) loginThrottled(accountKey, ipKey string) (bool, error) {
+	accountLockout, err := app.accountLimiter.Check(accountKey)
+	if err != nil {
+		return false, err
+	}
+	ipLockout, err := app.ipLimiter.Check(ipKey)
+	if err != nil {
+		return false, err
+	}
+	return accountLockout > 0 || ipLockout > 0, nil
+}
+
+// loginFailed records a failed login attempt against both limiters.
+func (app *application) loginFailed(accountKey, ipKey string) error {
+	_, err := app.accountLimiter.Fail(accountKey)
+	if err != nil {
+		return err
+	}
+	_, err = app.ipLimiter.Fail(ipKey)
+	return err
+}
+
+// errTooManyAttempts is returned by checkPassword while the user is locked out.
+var errTooManyAttempts = errors.New("too many failed password attempts")
+
+// checkPassword runs check, which checks the password that the logged-in user
+// entered to confirm an action. It is throttled in the same way as logging in,
+// and a wrong password counts as a failed login, so that a stolen session
+// can't be used to guess the password any faster than the login form allows.
+// While the account or the client IP is locked out, check isn't called at all
+// and the error is errTooManyAttempts.
+func (app *application) checkPassword(r *http.Request, check func(userID int) error) error {
+	user := app.authenticatedUser(r)
+	accountKey, ipKey := app.loginKeys(r, user.Email)
+	throttled, err := app.loginThrottled(accountKey, ipKey)
+	if err != nil {
+		return err
+	}
+	if throttled {
+		return errTooManyAttempts
+	}
+	err = check(user.ID)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		failErr := app.loginFailed(accountKey, ipKey)
+		if failErr != nil {
+			return failErr
+		}
+	}
+	return err
+}
+
+// logout logs out the session making the request. Use the RenewToken() method
+// to change the session ID again, then remove the keys which logging in put in
+// the session data so that the user is 'logged out'. The user_sessions record
+// is up to the caller.
+func (app *application) logout(r *http.Request) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Remove(r.Context(), "sessionID")
+	app.sessionManager.Remove(r.Context(), "authenticatedAt")
+	app.sessionManager.RememberMe(r.Context(), false)
+	return nil
+}
+
+// destroySessions deletes the sessions with the given tokens from the session
+// store, as returned by app.sessions.Tokens.
+func (app *application) destroySessions(tokens []string) error {
+	for _, token := range tokens {
+		err := app.sessionManager.Store.Delete(token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// newLogger returns a logger which writes to w as text or JSON, depending on
+// format. Lines logged with a request's context carry its request_id, and the
+// user_id once the user is known (see requestInfo). Errors also carry the
+// file and line they were logged from.
+func newLogger(w io.Writer, format string) *slog.Logger {
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(w, nil)
+	} else {
+		h = slog.NewTextHandler(w, nil)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// contextHandler adds the attributes described in newLogger to the records it
+// passes on to the wrapped handler.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.id))
+		if info.userID != 0 {
+			r.AddAttrs(slog.Int("user_id", info.userID))
+		}
+	}
+	if r.Level >= slog.LevelError && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		r.AddAttrs(slog.String("source", fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logError logs err at the error level, as coming from the caller of the
+// helper which calls logError, rather than from the helper itself.
+func (app *application) logError(ctx context.Context, err error, attrs ...slog.Attr) {
+	if !app.logger.Enabled(ctx, slog.LevelError) {
+		return
+	}
+	// Skip runtime.Callers, logError and the helper.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), slog.LevelError, err.Error(), pcs[0])
+	r.AddAttrs(attrs...)
+	_ = app.logger.Handler().Handle(ctx, r)
+}
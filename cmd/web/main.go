@@ -1,76 +1,141 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"database/sql" // New import
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os" // New import
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	//you can find it at the top of the go.mod file.
+	"GoWebPractice/internal/migrations"
 	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/storage"
+	"GoWebPractice/internal/validator"
 
-	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form"
-	_ "github.com/go-sql-driver/mysql" // 表示這個包會被導入，但不會在程式碼中直接使用這個包中的任何函數或類型。這種導入方式通常用於其副作用（side effects）。
 )
 
 // Add a snippets field to the application struct. This will allow us to
 // make the SnippetModel object available to our handlers.
 // 使我們的模型成為一個單一的、整齊封裝的對象，我們可以輕鬆地初始化該對象，然後將其作為依賴項傳遞給我們的處理程序
 type application struct {
-	debug          bool
-	errorLog       *log.Logger
-	infoLog        *log.Logger
-	snippets       models.SnippetModelInterface
-	users          models.UserModelInterface
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	debug              bool
+	deletionPolicy     models.DeletionPolicy
+	rememberMeLifetime time.Duration
+	reauthAfter        time.Duration
+	reportThreshold    int
+	logger             *slog.Logger
+	snippets           models.SnippetModelInterface
+	users              models.UserModelInterface
+	sessions           models.SessionModelInterface
+	reports            models.ReportModelInterface
+	auditLog           models.AuditModelInterface
+	tokens             models.TokenModelInterface
+	webhooks           models.WebhookModelInterface
+	webhookClient      *http.Client
+	feeds              *feedCache
+	embedOrigins       []string
+	secretScanner      *validator.SecretScanner
+	accountLimiter     models.LoginLimiterInterface
+	ipLimiter          models.LoginLimiterInterface
+	trustedProxies     []netip.Prefix // see clientIP
+	templateCache      map[string]*template.Template
+	formDecoder        *form.Decoder
+	sessionManager     *scs.SessionManager
+	// drainDelay and shutdownTimeout control how serve shuts down, draining
+	// is set once it has started to, and wg tracks the goroutines started
+	// with background.
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	draining        atomic.Bool
+	wg              sync.WaitGroup
 }
 
 func main() {
-	addr := flag.String("addr", ":4000", "HTTP network address")
-	// Define a new command-line flag for the MySQL DSN string.
-	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
-	// Create a new debug flag with the default value of false.
-	debug := flag.Bool("debug", false, "Enable debug mode")
-	flag.Parse()
-
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-
-	// To keep the main() function tidy I've put the code for creating a connection
-	// pool into the separate openDB() function below. We pass openDB() the DSN
-	// from the command-line flag.
-	db, err := openDB(*dsn)
+	// The settings come from a configuration file, the environment and the
+	// command-line flags (see internal/config).
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.LookupEnv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		err = cfg.Print(os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Log structured lines to standard output, as text or JSON as
+	// configured. Use the logger for the package-level functions of log/slog
+	// too.
+	logger := newLogger(os.Stdout, cfg.LogFormat)
+	slog.SetDefault(logger)
+
+	// To keep the main() function tidy the code for opening the database and
+	// creating the models lives in the storage package. We pass it the driver
+	// and DSN from the configuration.
+	store, err := storage.Open(cfg.DB.Driver, cfg.DB.DSN)
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	// We also defer a call to db.Close(), so that the connection pool is closed
-	// before the main() function exits.
-	defer db.Close()
+	// We also defer a call to store.Close(), so that the connection pool is
+	// closed before the main() function exits.
+	defer store.Close()
+
+	// Applying migrations needs a database user who is allowed to change the
+	// schema; otherwise run "admin migrate up" with a user who is. SQLite
+	// databases have no users, so they are always migrated.
+	if store.DB != nil && (cfg.DB.Migrate || store.Driver == "sqlite") {
+		applied, err := migrations.Up(store.DB, store.Driver)
+		for _, m := range applied {
+			logger.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
 	// Initialize a new template cache...
 	templateCache, err := newTemplateCache()
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 	// Initialize a decoder instance...
 	formDecoder := form.NewDecoder()
 
 	// Use the scs.New() function to initialize a new session manager. Then we
-	// configure it to use our MySQL database as the session store, and set a
-	// lifetime of 12 hours (so that sessions automatically expire 12 hours
-	// after first being created).
+	// configure it to keep sessions in the same database as everything else. The
+	// lifetime applies to every session, including anonymous ones; only
+	// "remember me" logins are given longer (see userLoginPost). Cookies are
+	// not persisted unless the user asks for it, so by default they are
+	// dropped when the browser is closed.
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Store = store.SessionStore
+	sessionManager.Lifetime = cfg.Session.Lifetime
+	sessionManager.Cookie.Persist = false
 	// sessionManager.Cookie.SameSite = http.SameSiteStrictMode
 	// 將阻止使用者瀏覽器發送的所有跨網站使用的會話 cookie — 包括使用 GET 和 HEAD 等 HTTP 方法的安全性請求。
 	// 缺點是當使用者從另一個網站點擊指向您的應用程式的連結時，不會發送會話 cookie。
@@ -84,58 +149,113 @@ func main() {
 	// unsecure HTTP connection).
 	sessionManager.Cookie.Secure = true
 
+	// Failed login attempts are tracked in the database by default so that
+	// every instance of the application shares the same lockouts. "mysql" is
+	// the old name of "db".
+	var accountLimiter, ipLimiter models.LoginLimiterInterface
+	if cfg.LoginLimiter == "memory" {
+		accountLimiter = models.NewMemoryLoginLimiter(models.DefaultAccountPolicy)
+		ipLimiter = models.NewMemoryLoginLimiter(models.DefaultIPPolicy)
+	} else {
+		accountLimiter = store.LoginLimiter(models.DefaultAccountPolicy)
+		ipLimiter = store.LoginLimiter(models.DefaultIPPolicy)
+	}
+
+	// New snippets are checked for secrets using the built-in rules, unless a
+	// JSON rules file is given (see validator.LoadSecretRules).
+	secretScanner := &validator.SecretScanner{Rules: validator.DefaultSecretRules()}
+	if cfg.SecretRules != "" {
+		secretScanner.Rules, err = loadSecretRules(cfg.SecretRules)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// validate() has checked these already.
+	origins, _ := cfg.Origins()
+	proxies, _ := cfg.Proxies()
+	curveIDs, _ := cfg.CurveIDs()
+
 	app := &application{
-		debug:          *debug, // Add the debug flag value to the application struct.
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		debug:              cfg.Debug, // Add the debug setting to the application struct.
+		deletionPolicy:     models.DeletionPolicy(cfg.DeletePolicy),
+		rememberMeLifetime: cfg.Session.RememberMeLifetime,
+		reauthAfter:        cfg.Session.ReauthAfter,
+		reportThreshold:    cfg.ReportThreshold,
+		logger:             logger,
+		snippets:           store.Snippets,
+		users:              store.Users,
+		sessions:           store.Sessions,
+		reports:            store.Reports,
+		auditLog:           store.AuditLog,
+		tokens:             store.Tokens,
+		webhooks:           store.Webhooks,
+		webhookClient:      newWebhookClient(cfg.Webhooks.AllowPrivate),
+		feeds:              newFeedCache(feedCacheTTL),
+		embedOrigins:       origins,
+		secretScanner:      secretScanner,
+		accountLimiter:     accountLimiter,
+		ipLimiter:          ipLimiter,
+		trustedProxies:     proxies,
+		templateCache:      templateCache,
+		formDecoder:        formDecoder,
+		sessionManager:     sessionManager,
+		drainDelay:         cfg.Server.DrainDelay,
+		shutdownTimeout:    cfg.Server.ShutdownTimeout,
 	}
 	// Initialize a tls.Config struct to hold the non-default TLS settings we
 	// want the server to use. In this case the only thing that we're changing
-	// is the curve preferences value, so that only elliptic curves with
-	// assembly implementations are used.
+	// is the curve preferences value, which by default only allows elliptic
+	// curves with assembly implementations.
 	tlsConfig := &tls.Config{
-		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CurvePreferences: curveIDs,
 	}
 	// Set the server's TLSConfig field to use the tlsConfig variable we just
 	// created.
 	srv := &http.Server{ // 使用指針型態才可以在整個專案共享服務器配置
-		Addr:     *addr,
-		ErrorLog: errorLog,
+		Addr: cfg.Addr,
+		// The server's own errors, such as failed TLS handshakes, go to the
+		// same log.
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		// Call the new app.routes() method to get the servemux containing our routes.
 		Handler:   app.routes(), // 1.22 版本之後可以直接 wrap 在 router 之外
 		TLSConfig: tlsConfig,
 		// Add Idle, Read and Write timeouts to the server.
-		IdleTimeout:    time.Minute,
-		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 524288,
+		IdleTimeout:    cfg.Server.IdleTimeout,
+		ReadTimeout:    cfg.Server.ReadTimeout,
+		WriteTimeout:   cfg.Server.WriteTimeout,
+		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
 	}
 
-	infoLog.Printf("Starting server on %s", *addr)
-	// Use the ListenAndServeTLS() method to start the HTTPS server. We
-	// pass in the paths to the TLS certificate and corresponding private key as
-	// the two parameters.
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	errorLog.Fatal(err)
-}
+	// SIGINT (Ctrl-C) and SIGTERM start a graceful shutdown. A second signal
+	// stops the server straight away.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-// The openDB() function wraps sql.Open() and returns a sql.DB connection pool
-// for a given DSN.
-func openDB(dsn string) (*sql.DB, error) {
-	// sql.Open() 函數實際上並沒有創建任何連接，它所做的只是初始化池以供將來使用
-	db, err := sql.Open("mysql", dsn)
+	ln, err := net.Listen("tcp", cfg.Addr)
 	if err != nil {
-		return nil, err
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
-	// 與資料庫的實際連線是在第一次需要時延遲建立的。
-	// 因此，為了驗證一切設定是否正確，我們需要使用 db.Ping() 方法來建立連線並檢查是否有任何錯誤。
-	if err = db.Ping(); err != nil {
+	err = app.serve(ctx, srv, ln, cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		logger.Error(err.Error())
+		store.Close()
+		os.Exit(1)
+	}
+	logger.Info("stopped server")
+}
+
+// loadSecretRules reads the secret scanning rules from a JSON file.
+func loadSecretRules(path string) ([]validator.SecretRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
 		return nil, err
 	}
-	return db, nil
+	defer f.Close()
+	return validator.LoadSecretRules(f)
 }
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"GoWebPractice/internal/models"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/justinas/nosurf" // 使用雙重提交 cookie 模式來防止攻擊。
@@ -14,8 +19,7 @@ import (
 
 func secureHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Security-Policy",
-			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy())
 		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "deny")
@@ -24,9 +28,33 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// contentSecurityPolicy returns the CSP header for pages which may be shown in
+// frames by the given sources. With no sources, they can't be framed at all.
+func contentSecurityPolicy(frameAncestors ...string) string {
+	ancestors := "'none'"
+	if len(frameAncestors) > 0 {
+		ancestors = strings.Join(frameAncestors, " ")
+	}
+	return "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com; frame-ancestors " + ancestors
+}
+
+// allowFraming lets the routes it wraps be framed by the site itself and by
+// the -embed-origins, replacing the deny-all defaults of secureHeaders.
+// X-Frame-Options can't name more than one origin, so it is dropped and
+// browsers go by frame-ancestors instead.
+func (app *application) allowFraming(next http.Handler) http.Handler {
+	csp := contentSecurityPolicy(append([]string{"'self'"}, app.embedOrigins...)...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", csp)
+		w.Header().Del("X-Frame-Options")
+		next.ServeHTTP(w, r)
+	})
+}
+
 type warpWriter struct {
 	http.ResponseWriter
 	statusCode int
+	size       int
 }
 
 // The method writeHeader is renamed to WriteHeader to correctly override the ResponseWriter interface's WriteHeader method.
@@ -35,6 +63,61 @@ func (w *warpWriter) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 }
 
+// Write counts the bytes of the response body.
+func (w *warpWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// maxRequestIDLength is the longest X-Request-ID header that requestID
+// accepts from the client.
+const maxRequestIDLength = 128
+
+// requestID gives every request an ID, which is added to its log lines and
+// sent back in the X-Request-ID header. An X-Request-ID sent by the client,
+// or a load balancer in front of us, is used if it looks sane, so that the
+// request can be followed from one to the other; otherwise a random one is
+// made up.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, &requestInfo{id: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether id is short and made only of characters
+// which can't confuse anybody reading the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-_.:+/=", c) >= 0
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// logRequest logs every request once it has been handled, with the response
+// status, size and how long it took. The request and user IDs are added by
+// the logger.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -43,7 +126,13 @@ func (app *application) logRequest(next http.Handler) http.Handler {
 			statusCode:     http.StatusOK,
 		}
 		next.ServeHTTP(wrapped, r)
-		app.infoLog.Printf("%d %s %s %s", wrapped.statusCode, r.Method, r.URL.RequestURI(), time.Since(start))
+		app.logger.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", wrapped.statusCode,
+			"size", wrapped.size,
+			"duration", time.Since(start),
+		)
 	})
 }
 
@@ -59,7 +148,7 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 				w.Header().Set("Connection", "close")
 				// Call the app.serverError helper method to return a 500
 				// Internal Server response.
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 		next.ServeHTTP(w, r)
@@ -87,6 +176,45 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireRecentAuth makes the user enter their password again if they last did
+// so longer ago than app.reauthAfter. It must be used after
+// requireAuthentication.
+func (app *application) requireRecentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The time is stored as a Unix timestamp, because the session codec
+		// can't encode a time.Time without registering it with gob first.
+		authenticatedAt := time.Unix(app.sessionManager.GetInt64(r.Context(), "authenticatedAt"), 0)
+		if time.Since(authenticatedAt) > app.reauthAfter {
+			// Only a GET request can be repeated after the redirect. For
+			// anything else we send the user back to their account page.
+			path := "/account/view"
+			if r.Method == http.MethodGet {
+				path = r.URL.RequestURI()
+			}
+			app.sessionManager.Put(r.Context(), "redirectPathAfterReauth", path)
+			http.Redirect(w, r, "/user/reauth", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireRole returns middleware which only lets through users who have one
+// of the given roles, and responds with 403 Forbidden to everybody else. It
+// must be used after requireAuthentication.
+func (app *application) requireRole(roles ...models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.authenticatedUser(r)
+			if user == nil || !user.HasRole(roles...) {
+				app.clientError(w, r, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Create a NoSurf middleware function which uses a customized CSRF cookie with
 // the Secure, Path and HttpOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
@@ -112,20 +240,38 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		// Otherwise, we check to see if a user with that ID exists in our
-		// database.
-		exists, err := app.users.Exists(id)
-		if err != nil {
-			app.serverError(w, err)
+		// Otherwise, we load the user with that ID from our database, and
+		// check that their account is still active.
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
 			return
 		}
-		// If a matching user is found, we know we know that the request is
-		// coming from an authenticated user who exists in our database. We
-		// create a new copy of the request (with an isAuthenticatedContextKey
-		// value of true in the request context) and assign it to r.
-		if exists {
-			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
-			r = r.WithContext(ctx)
+		valid := user != nil && user.Active
+		// The session itself must not have been revoked from the account page
+		// either. This also updates the "last seen" time shown there.
+		if valid {
+			sessionID := app.sessionManager.GetString(r.Context(), "sessionID")
+			valid, err = app.sessions.Touch(sessionID, id)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+		// If everything checks out, we know that the request is coming from
+		// an authenticated user who exists in our database. We create a new
+		// copy of the request with the user in the request context, so that
+		// handlers and other middleware can check who they are and what role
+		// they have without going back to the database.
+		if valid {
+			r = contextSetAuthenticatedUser(r, user)
+		} else {
+			// The account has been deactivated (or removed) or the session has
+			// been revoked since it was created, so log this session out. Every
+			// other affected session is logged out the same way on its next
+			// request.
+			app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+			app.sessionManager.Remove(r.Context(), "sessionID")
 		}
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
@@ -135,3 +281,67 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 //authMiddleware：通過 r.WithContext(ctx) 創建了一個新的請求對象，該對象包含了更新的上下文，
 // 而不是直接修改原始請求。這樣做可以保證原始請求對象的不可變性。
 //handler：可以安全地從上下文中讀取數據，而不用擔心其他中間件或處理器對原始請求的修改。
+
+// authenticateToken lets JSON API clients authenticate with a personal API
+// token in an "Authorization: Bearer <token>" header. A token takes the place
+// of any session cookie sent with the request. Requests with a bad token are
+// refused outright rather than treated as anonymous, so that a typo doesn't
+// silently turn into a 404 or an empty list.
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			app.invalidTokenResponse(w)
+			return
+		}
+		apiToken, err := app.tokens.Authenticate(token)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.invalidTokenResponse(w)
+			} else {
+				app.apiServerError(w, r, err)
+			}
+			return
+		}
+		user, err := app.users.Get(apiToken.UserID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.apiServerError(w, r, err)
+			return
+		}
+		if user == nil || !user.Active {
+			app.invalidTokenResponse(w)
+			return
+		}
+		r = contextSetAuthenticatedUser(r, user)
+		ctx := context.WithValue(r.Context(), tokenScopeContextKey, apiToken.Scope)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) invalidTokenResponse(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	app.apiError(w, http.StatusUnauthorized, "invalid or expired API token")
+}
+
+// requireScope refuses requests made with an API token which lacks the given
+// scope. Requests authenticated with a session cookie may do anything the user
+// can do.
+func (app *application) requireScope(scope models.TokenScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenScope, ok := r.Context().Value(tokenScopeContextKey).(models.TokenScope)
+			if ok && !tokenScope.Allows(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+				app.apiError(w, http.StatusForbidden, fmt.Sprintf("this API token needs the %q scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
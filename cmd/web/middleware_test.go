@@ -2,10 +2,15 @@ package main
 
 import (
 	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/models"
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -31,7 +36,7 @@ func TestSecureHeaders(t *testing.T) {
 	rs := rr.Result()
 	// Check that the middleware has correctly set the Content-Security-Policy
 	// header on the response.
-	expectedValue := "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com"
+	expectedValue := "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com; frame-ancestors 'none'"
 	assert.Equal(t, rs.Header.Get("Content-Security-Policy"), expectedValue)
 	// Check that the middleware has correctly set the Referrer-Policy
 	// header on the response.
@@ -60,3 +65,170 @@ func TestSecureHeaders(t *testing.T) {
 	bytes.TrimSpace(body)
 	assert.Equal(t, string(body), "OK")
 }
+
+func TestRequireRole(t *testing.T) {
+	app := newTestApplication(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		roles    []models.Role
+		wantCode int
+	}{
+		{name: "Anonymous", user: nil, roles: []models.Role{models.RoleAdmin}, wantCode: http.StatusForbidden},
+		{name: "User", user: &models.User{ID: 1, Role: models.RoleUser}, roles: []models.Role{models.RoleAdmin}, wantCode: http.StatusForbidden},
+		{name: "Admin", user: &models.User{ID: 4, Role: models.RoleAdmin}, roles: []models.Role{models.RoleAdmin}, wantCode: http.StatusOK},
+		{name: "Moderator allowed", user: &models.User{ID: 3, Role: models.RoleModerator}, roles: []models.Role{models.RoleModerator, models.RoleAdmin}, wantCode: http.StatusOK},
+		{name: "Moderator refused", user: &models.User{ID: 3, Role: models.RoleModerator}, roles: []models.Role{models.RoleAdmin}, wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Put the user on the context in the same way that the
+			// authenticate middleware does.
+			if tt.user != nil {
+				r = contextSetAuthenticatedUser(r, tt.user)
+			}
+			app.requireRole(tt.roles...)(next).ServeHTTP(rr, r)
+			assert.Equal(t, rr.Code, tt.wantCode)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+	tests := []struct {
+		name     string
+		incoming string
+		wantID   string
+	}{
+		{name: "Incoming ID", incoming: "lb-7f3a.2:1", wantID: "lb-7f3a.2:1"},
+		{name: "No ID", incoming: ""},
+		{name: "Unsafe characters", incoming: "abc\" level=ERROR"},
+		{name: "Too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			var seen string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestInfoFrom(r.Context()).id
+			})
+			rr := httptest.NewRecorder()
+			app.requestID(next).ServeHTTP(rr, r)
+
+			id := rr.Header().Get("X-Request-ID")
+			assert.Equal(t, seen, id)
+			if tt.wantID != "" {
+				assert.Equal(t, id, tt.wantID)
+				return
+			}
+			// A new ID is 16 random bytes in hex.
+			_, err := hex.DecodeString(id)
+			assert.NilError(t, err)
+			assert.Equal(t, len(id), 32)
+		})
+	}
+}
+
+// decodeLogLines returns the JSON log lines written to buf.
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]any
+		err := dec.Decode(&line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLogRequest(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.logger = newLogger(&buf, "json")
+
+	// The user is only known further down the chain, after logRequest has
+	// passed the request on.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = contextSetAuthenticatedUser(r, &models.User{ID: 7})
+		app.logger.InfoContext(r.Context(), "handling")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+	r := httptest.NewRequest(http.MethodGet, "/snippet/view/1?x=y", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	app.requestID(app.logRequest(next)).ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := decodeLogLines(t, &buf)
+	assert.Equal(t, len(lines), 2)
+	for _, line := range lines {
+		assert.Equal(t, line["request_id"], any("req-1"))
+		assert.Equal(t, line["user_id"], any(7.0))
+	}
+	line := lines[1]
+	assert.Equal(t, line["msg"], any("request"))
+	assert.Equal(t, line["method"], any(http.MethodGet))
+	assert.Equal(t, line["uri"], any("/snippet/view/1?x=y"))
+	assert.Equal(t, line["status"], any(float64(http.StatusCreated)))
+	assert.Equal(t, line["size"], any(5.0))
+	if _, ok := line["duration"].(float64); !ok {
+		t.Errorf("got duration %v; want a number", line["duration"])
+	}
+}
+
+func TestServerError(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		wantBody string
+	}{
+		{name: "HTML", wantBody: "Internal Server Error\n\nRequest ID: req-2\n"},
+		{name: "JSON", accept: "application/json", wantBody: "{\n\t\"error\": \"Internal Server Error\",\n\t\"request_id\": \"req-2\"\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			var buf bytes.Buffer
+			app.logger = newLogger(&buf, "json")
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				app.serverError(w, r, errors.New("boom"))
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Request-ID", "req-2")
+			r.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			app.requestID(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, http.StatusInternalServerError)
+			assert.Equal(t, rr.Body.String(), tt.wantBody)
+
+			lines := decodeLogLines(t, &buf)
+			assert.Equal(t, len(lines), 1)
+			line := lines[0]
+			assert.Equal(t, line["level"], any("ERROR"))
+			assert.Equal(t, line["msg"], any("boom"))
+			assert.Equal(t, line["request_id"], any("req-2"))
+			// The line is attributed to serverError's caller, and the stack
+			// trace is an attribute of its own rather than part of the message.
+			source, _ := line["source"].(string)
+			assert.StringContains(t, source, "middleware_test.go:")
+			trace, _ := line["trace"].(string)
+			assert.StringContains(t, trace, "runtime/debug.Stack")
+		})
+	}
+}
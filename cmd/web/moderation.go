@@ -0,0 +1,190 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type snippetReportForm struct {
+	Reason              models.ReportReason `form:"reason"`
+	Details             string              `form:"details"`
+	validator.Validator `form:"-"`
+}
+
+type moderationDecisionForm struct {
+	Decision models.Decision `form:"decision"`
+}
+
+// snippetReportPost lets anybody, logged in or not, report a snippet. Once a
+// snippet has app.reportThreshold open reports from logged-in users it is
+// hidden until a moderator has looked at it. Anonymous reports still go to the
+// queue, but don't count towards hiding it, because anybody with a few IP
+// addresses could otherwise hide any snippet they liked.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	var form snippetReportForm
+	err = app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.PermittedValue(form.Reason, models.ReportReasons...), "reason", "Please choose a reason")
+	form.CheckField(validator.MaxChars(form.Details, 1000), "details", "This field cannot be more than 1000 characters long")
+	if form.Reason == models.ReasonOther {
+		form.CheckField(validator.NotBlank(form.Details), "details", "Please tell us what is wrong with this snippet")
+	}
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "view.tmpl", data)
+		return
+	}
+
+	reporter := "ip:" + app.clientIP(r)
+	if user := app.authenticatedUser(r); user != nil {
+		reporter = fmt.Sprintf("user:%d", user.ID)
+	}
+	open, err := app.reports.Insert(id, reporter, form.Reason, form.Details)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateReport) {
+			app.sessionManager.Put(r.Context(), "flash", "You have already reported this snippet.")
+			http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "snippet_report", "snippet_id=%d reporter=%s reason=%s", id, reporter, form.Reason)
+
+	if app.reportThreshold > 0 && open >= app.reportThreshold {
+		err = app.snippets.SetHidden(id, true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.audit(r, "snippet_auto_hide", "snippet_id=%d reports=%d", id, open)
+		app.sessionManager.Put(r.Context(), "flash", "Thanks for your report. The snippet has been hidden until a moderator reviews it.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for your report. A moderator will review it shortly.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+func (app *application) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	filter := readFilter(r)
+	reports, metadata, err := app.reports.Open(filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Reports = reports
+	data.Metadata = metadata
+	app.render(w, r, http.StatusOK, "moderation.tmpl", data)
+}
+
+// moderationDecisionPost closes every open report for a snippet with the
+// moderator's decision, and then carries it out.
+func (app *application) moderationDecisionPost(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+	var form moderationDecisionForm
+	err = app.decodePostForm(r, &form)
+	if err != nil || !validator.PermittedValue(form.Decision, models.Decisions...) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	authorID, err := app.snippets.Owner(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	moderator := app.authenticatedUser(r)
+	if form.Decision == models.DecisionBan {
+		if authorID == 0 {
+			app.sessionManager.Put(r.Context(), "flash", "This snippet was posted anonymously, so there is nobody to ban.")
+			http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+			return
+		}
+		// Bans are for ordinary users. Staff accounts are dealt with by an
+		// admin on the users page, and nobody can lock themselves out.
+		author, err := app.users.Get(authorID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		if authorID == moderator.ID || (author != nil && author.HasRole(models.RoleModerator, models.RoleAdmin)) {
+			app.sessionManager.Put(r.Context(), "flash", "You can't ban a moderator or admin. Hide the snippet instead.")
+			http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+			return
+		}
+	}
+
+	moderatorID := moderator.ID
+	err = app.reports.Resolve(id, moderatorID, form.Decision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	switch form.Decision {
+	case models.DecisionDismiss:
+		err = app.snippets.SetHidden(id, false)
+	case models.DecisionHide:
+		err = app.snippets.SetHidden(id, true)
+	case models.DecisionBan:
+		err = app.snippets.SetHidden(id, true)
+		// Deactivated users are logged out by the authenticate middleware
+		// on their next request, and their other snippets are hidden too.
+		if err == nil {
+			err = app.users.SetActive(authorID, false)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "moderation_decision", "snippet_id=%d decision=%s author_id=%d", id, form.Decision, authorID)
+	app.sessionManager.Put(r.Context(), "flash", "Your decision has been recorded.")
+	http.Redirect(w, r, "/moderation", http.StatusSeeOther)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"GoWebPractice/ui"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// openAPIPath is where the OpenAPI document lives in ui.Files.
+const openAPIPath = "api/openapi.json"
+
+// openAPIMethods are the operation keys of an OpenAPI path item, in the order
+// in which the docs page lists them.
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// openAPISpec is the part of the OpenAPI document used by the docs page.
+type openAPISpec struct {
+	Info struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref         string `json:"$ref"`
+	Description string `json:"description"`
+}
+
+// apiDocs is the OpenAPI document in the shape used by the docs template.
+type apiDocs struct {
+	Title       string
+	Version     string
+	Description string
+	Endpoints   []apiEndpoint
+}
+
+type apiEndpoint struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Responses   []apiResponse
+}
+
+type apiResponse struct {
+	Status      string
+	Description string
+}
+
+// loadAPIDocs reads the embedded OpenAPI document.
+func loadAPIDocs() (*apiDocs, error) {
+	b, err := ui.Files.ReadFile(openAPIPath)
+	if err != nil {
+		return nil, err
+	}
+	var spec openAPISpec
+	err = json.Unmarshal(b, &spec)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := &apiDocs{Title: spec.Info.Title, Version: spec.Info.Version, Description: spec.Info.Description}
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, method := range openAPIMethods {
+			raw, ok := spec.Paths[path][method]
+			if !ok {
+				continue
+			}
+			var op openAPIOperation
+			err = json.Unmarshal(raw, &op)
+			if err != nil {
+				return nil, err
+			}
+			endpoint := apiEndpoint{
+				Method:      strings.ToUpper(method),
+				Path:        path,
+				Summary:     op.Summary,
+				Description: op.Description,
+			}
+			for status, response := range op.Responses {
+				if name, ok := strings.CutPrefix(response.Ref, "#/components/responses/"); ok {
+					response = spec.Components.Responses[name]
+				}
+				endpoint.Responses = append(endpoint.Responses, apiResponse{Status: status, Description: response.Description})
+			}
+			sort.Slice(endpoint.Responses, func(i, j int) bool {
+				return endpoint.Responses[i].Status < endpoint.Responses[j].Status
+			})
+			docs.Endpoints = append(docs.Endpoints, endpoint)
+		}
+	}
+	return docs, nil
+}
+
+// apiOpenAPI serves the OpenAPI document describing the JSON API.
+func (app *application) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	b, err := ui.Files.ReadFile(openAPIPath)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// apiDocsPage shows the OpenAPI document as a human-readable page.
+func (app *application) apiDocsPage(w http.ResponseWriter, r *http.Request) {
+	docs, err := loadAPIDocs()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.APIDocs = docs
+	app.render(w, r, http.StatusOK, "api-docs.tmpl", data)
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"GoWebPractice/internal/models"
 	"GoWebPractice/ui" // New import
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
@@ -11,7 +14,18 @@ import (
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.notFound(w)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiError(w, http.StatusNotFound, "the requested resource could not be found")
+			return
+		}
+		app.notFound(w, r)
+	})
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			app.apiError(w, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+			return
+		}
+		app.clientError(w, r, http.StatusMethodNotAllowed)
 	})
 
 	// Take the ui.Files embedded filesystem and convert it to a http.FS type so
@@ -28,24 +42,92 @@ func (app *application) routes() http.Handler {
 
 	// Add a new GET /ping route.
 	router.HandlerFunc(http.MethodGet, "/ping", ping)
+	router.HandlerFunc(http.MethodGet, "/ready", app.ready)
+
+	// Feeds don't use sessions, so that they can be cached by anybody.
+	router.HandlerFunc(http.MethodGet, "/feed.atom", app.feedAtom)
+	router.HandlerFunc(http.MethodGet, "/feed.rss", app.feedRSS)
+	router.HandlerFunc(http.MethodGet, "/users/:id/feed.atom", app.userFeedAtom)
+	router.HandlerFunc(http.MethodGet, "/users/:id/feed.rss", app.userFeedRSS)
+
+	// oEmbed and the embed pages it points to. Only the embed pages can be
+	// shown in frames, and only on the -embed-origins.
+	router.HandlerFunc(http.MethodGet, "/oembed", app.oEmbed)
+	router.Handler(http.MethodGet, "/embed/:id", alice.New(app.allowFraming).ThenFunc(app.snippetEmbed))
 
 	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/about", dynamic.ThenFunc(app.about))
+	router.Handler(http.MethodGet, "/api/docs", dynamic.ThenFunc(app.apiDocsPage))
 	router.Handler(http.MethodGet, "/snippet/view/:id", dynamic.ThenFunc(app.snippetView))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignupPost))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLogin))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLoginPost))
+	router.Handler(http.MethodPost, "/snippet/report/:id", dynamic.ThenFunc(app.snippetReportPost))
 	// Protected (authenticated-only) application routes, using a new "protected"
 	// middleware chain which includes the requireAuthentication middleware.
 	protected := dynamic.Append(app.requireAuthentication)
 	router.Handler(http.MethodGet, "/snippet/create", protected.ThenFunc(app.snippetCreate))
 	router.Handler(http.MethodPost, "/snippet/create", protected.ThenFunc(app.snippetCreatePost))
 	router.Handler(http.MethodGet, "/account/view", protected.ThenFunc(app.accountView))
-	router.Handler(http.MethodGet, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdate))
-	router.Handler(http.MethodPost, "/account/password/update", protected.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodGet, "/account/sessions", protected.ThenFunc(app.accountSessions))
+	router.Handler(http.MethodPost, "/account/sessions/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionsRevokeOthersPost))
+	router.Handler(http.MethodGet, "/account/tokens", protected.ThenFunc(app.accountTokens))
+	router.Handler(http.MethodPost, "/account/tokens/revoke", protected.ThenFunc(app.accountTokenRevokePost))
+	router.Handler(http.MethodGet, "/account/webhooks", protected.ThenFunc(app.accountWebhooks))
+	router.Handler(http.MethodPost, "/account/webhooks", protected.ThenFunc(app.accountWebhookCreatePost))
+	router.Handler(http.MethodGet, "/account/webhooks/:id", protected.ThenFunc(app.accountWebhookView))
+	router.Handler(http.MethodPost, "/account/webhooks/:id/test", protected.ThenFunc(app.accountWebhookTestPost))
+	router.Handler(http.MethodPost, "/account/webhooks/:id/delete", protected.ThenFunc(app.accountWebhookDeletePost))
+	router.Handler(http.MethodGet, "/user/reauth", protected.ThenFunc(app.userReauth))
+	router.Handler(http.MethodPost, "/user/reauth", protected.ThenFunc(app.userReauthPost))
 	router.Handler(http.MethodPost, "/user/logout", protected.ThenFunc(app.userLogoutPost))
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+
+	// Sensitive account actions additionally require the password to have
+	// been entered recently.
+	sensitive := protected.Append(app.requireRecentAuth)
+	router.Handler(http.MethodGet, "/account/password/update", sensitive.ThenFunc(app.accountPasswordUpdate))
+	router.Handler(http.MethodPost, "/account/password/update", sensitive.ThenFunc(app.accountPasswordUpdatePost))
+	router.Handler(http.MethodPost, "/account/deactivate", sensitive.ThenFunc(app.accountDeactivatePost))
+	router.Handler(http.MethodPost, "/account/tokens", sensitive.ThenFunc(app.accountTokenCreatePost))
+	router.Handler(http.MethodGet, "/account/export", sensitive.ThenFunc(app.accountExport))
+	router.Handler(http.MethodGet, "/account/delete", sensitive.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete", sensitive.ThenFunc(app.accountDeletePost))
+
+	// Admin-only routes.
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodGet, "/admin/users", admin.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodGet, "/admin/users/:id", admin.ThenFunc(app.adminUserView))
+	router.Handler(http.MethodPost, "/admin/users/:id/deactivate", admin.ThenFunc(app.adminUserDeactivatePost))
+	router.Handler(http.MethodPost, "/admin/users/:id/reactivate", admin.ThenFunc(app.adminUserReactivatePost))
+	router.Handler(http.MethodPost, "/admin/users/:id/role", admin.ThenFunc(app.adminUserRolePost))
+	router.Handler(http.MethodGet, "/admin/snippets", admin.ThenFunc(app.adminSnippets))
+	router.Handler(http.MethodPost, "/admin/snippets/:id/delete", admin.ThenFunc(app.adminSnippetDeletePost))
+	router.Handler(http.MethodPost, "/admin/snippets/:id/restore", admin.ThenFunc(app.adminSnippetRestorePost))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(app.adminAudit))
+
+	// The moderation queue is open to moderators and admins.
+	moderator := protected.Append(app.requireRole(models.RoleModerator, models.RoleAdmin))
+	router.Handler(http.MethodGet, "/moderation", moderator.ThenFunc(app.moderationQueue))
+	router.Handler(http.MethodPost, "/moderation/snippets/:id", moderator.ThenFunc(app.moderationDecisionPost))
+
+	// The JSON API has its own chain without noSurf. Clients authenticate
+	// with a personal API token, or with the session cookie. The cookie is
+	// safe without CSRF tokens because requests with a body must be sent as
+	// application/json and the other write method is DELETE; browsers won't
+	// send either cross-site without a CORS preflight, which we never allow.
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.authenticateToken)
+	router.Handler(http.MethodGet, "/api/v1/openapi.json", api.ThenFunc(app.apiOpenAPI))
+	router.Handler(http.MethodGet, "/api/v1/snippets", api.ThenFunc(app.apiSnippetList))
+	router.Handler(http.MethodGet, "/api/v1/snippets/:id", api.ThenFunc(app.apiSnippetGet))
+	apiProtected := api.Append(app.requireAPIAuthentication, app.requireScope(models.ScopeWrite))
+	router.Handler(http.MethodPost, "/api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate))
+	router.Handler(http.MethodPut, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetUpdate))
+	router.Handler(http.MethodDelete, "/api/v1/snippets/:id", apiProtected.ThenFunc(app.apiSnippetDelete))
+
+	standard := alice.New(app.requestID, app.recoverPanic, app.logRequest, secureHeaders)
 	return standard.Then(router)
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// serve runs the HTTPS server on ln, together with the background workers,
+// until ctx is cancelled (main cancels it on SIGINT or SIGTERM). It then shuts
+// down in stages, so that a deploy doesn't cut anything off half way:
+//
+//  1. /ready starts failing, and for app.drainDelay the server carries on as
+//     normal while load balancers notice and stop sending it new requests.
+//  2. srv.Shutdown stops accepting connections and waits up to
+//     app.shutdownTimeout for the requests in flight to finish.
+//  3. The background workers are told to stop, and waited for.
+//
+// serve returns nil if everything stopped in time.
+func (app *application) serve(ctx context.Context, srv *http.Server, ln net.Listener, certFile, keyFile string) error {
+	// The workers get their own context, which is only cancelled once the
+	// requests have finished, because those can still queue work for them.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	// Queued webhook events are sent in the background.
+	app.background(workerCtx, app.runWebhookWorker)
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		app.logger.Info("shutting down: waiting for load balancers to drain", "drain_delay", app.drainDelay)
+		app.draining.Store(true)
+		time.Sleep(app.drainDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(shutdownCtx)
+		if err != nil {
+			shutdownErr <- fmt.Errorf("shutting down the server: %w", err)
+			return
+		}
+
+		stopWorkers()
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			shutdownErr <- nil
+		case <-shutdownCtx.Done():
+			shutdownErr <- errors.New("shutting down: background workers didn't stop in time")
+		}
+	}()
+
+	app.logger.Info("starting server", "addr", ln.Addr().String())
+	// Use the ServeTLS() method to start the HTTPS server. We pass in the
+	// paths to the TLS certificate and corresponding private key.
+	err := srv.ServeTLS(ln, certFile, keyFile)
+	// Shutdown makes ServeTLS return ErrServerClosed straight away, before
+	// the requests in flight have finished, so wait for the rest of the
+	// shutdown to finish too.
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdownErr
+}
+
+// background runs fn in a goroutine which serve waits for when shutting
+// down. fn should return soon after ctx is cancelled. A panic in fn is logged
+// rather than taking the whole server down.
+func (app *application) background(ctx context.Context, fn func(ctx context.Context)) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background job panicked", "error", err, "trace", string(debug.Stack()))
+			}
+		}()
+		fn(ctx)
+	}()
+}
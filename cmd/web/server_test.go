@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"GoWebPractice/internal/assert"
+)
+
+// startServe runs app.serve with h on a local port, until the returned
+// context.CancelFunc is called. serve's result is sent on the channel. It
+// borrows the certificate of an httptest server, and returns that server's
+// client, which trusts it.
+func startServe(t *testing.T, app *application, h http.Handler) (string, *http.Client, context.CancelFunc, <-chan error) {
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	certServer.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: h, TLSConfig: certServer.TLS}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	served := make(chan error, 1)
+	go func() {
+		served <- app.serve(ctx, srv, ln, "", "")
+	}()
+	return "https://" + ln.Addr().String(), certServer.Client(), cancel, served
+}
+
+func TestServeShutdown(t *testing.T) {
+	app := newTestApplication(t)
+	app.drainDelay = 100 * time.Millisecond
+	app.shutdownTimeout = 5 * time.Second
+
+	// A slow request stands in for the requests in flight during a deploy.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/", app.routes())
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	url, client, shutdown, served := startServe(t, app, mux)
+
+	get := func(path string) (int, string) {
+		rs, err := client.Get(url + path)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer rs.Body.Close()
+		body, _ := io.ReadAll(rs.Body)
+		return rs.StatusCode, string(body)
+	}
+
+	code, _ := get("/ready")
+	assert.Equal(t, code, http.StatusOK)
+
+	slow := make(chan string, 1)
+	go func() {
+		_, body := get("/slow")
+		slow <- body
+	}()
+	<-started
+	shutdown()
+
+	// While draining, the server still answers, but isn't ready.
+	time.Sleep(app.drainDelay / 4)
+	code, body := get("/ready")
+	assert.Equal(t, code, http.StatusServiceUnavailable)
+	assert.StringContains(t, body, "shutting down")
+
+	// serve waits for the request in flight, and then for the webhook
+	// worker to stop.
+	time.Sleep(2 * app.drainDelay)
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned %v before the request in flight finished", err)
+	default:
+	}
+	close(release)
+	assert.Equal(t, <-slow, "done")
+	assert.NilError(t, <-served)
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	app := newTestApplication(t)
+	app.drainDelay = 0
+	app.shutdownTimeout = 100 * time.Millisecond
+
+	// A background job which ignores its context holds up the shutdown
+	// until the timeout.
+	release := make(chan struct{})
+	defer close(release)
+	app.background(context.Background(), func(context.Context) {
+		<-release
+	})
+	_, _, shutdown, served := startServe(t, app, app.routes())
+
+	shutdown()
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("got nil; want an error about the background workers")
+		}
+		assert.StringContains(t, err.Error(), "background workers")
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after the shutdown timeout")
+	}
+}
@@ -28,14 +28,32 @@ var functions = template.FuncMap{
 
 // Include a Snippets field in the templateData struct.
 type templateData struct {
-	CurrentYear     int
-	Snippet         *models.Snippet
-	Snippets        []*models.Snippet
-	Form            any
-	Flash           string
-	IsAuthenticated bool
-	CSRFToken       string // Add a CSRFToken field.
-	User            *models.User
+	CurrentYear       int
+	Snippet           *models.Snippet
+	Snippets          []*models.Snippet
+	Form              any
+	Flash             string
+	IsAuthenticated   bool
+	AuthenticatedUser *models.User
+	CSRFToken         string // Add a CSRFToken field.
+	User              *models.User
+	Sessions          []*models.Session
+	CurrentSessionID  string
+	Users             []*models.User
+	Metadata          models.Metadata
+	Query             string
+	Dashboard         *adminDashboard
+	Roles             []models.Role
+	Reports           []*models.Report
+	AuditEntries      []*models.AuditEntry
+	AuditVerified     bool
+	AuditBrokenID     int
+	Tokens            []*models.APIToken
+	NewToken          string
+	Webhooks          []*models.Webhook
+	Webhook           *models.Webhook
+	WebhookDeliveries []*models.WebhookDelivery
+	APIDocs           *apiDocs
 }
 
 func newTemplateCache() (map[string]*template.Template, error) {
@@ -53,7 +71,7 @@ func newTemplateCache() (map[string]*template.Template, error) {
 		// Create a slice containing the filepath patterns for the templates we
 		// want to parse.
 		patterns := []string{
-			"html/base.tmpl", "html/partials/*.tmpl", page,
+			"html/base.tmpl", "html/embed.tmpl", "html/partials/*.tmpl", page,
 		}
 		// Use ParseFS() instead of ParseFiles() to parse the template files
 		// from the ui.Files embedded filesystem.
@@ -4,16 +4,19 @@ import (
 	"bytes"
 	"html"
 	"io"
-	"log"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"GoWebPractice/internal/config"
+	"GoWebPractice/internal/models"
 	"GoWebPractice/internal/models/mocks" // New import
+	"GoWebPractice/internal/validator"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form"
@@ -34,18 +37,34 @@ func newTestApplication(t *testing.T) *application {
 	// production, except that we *don't* set a Store for the session manager.
 	// If no store is set, the SCS package will default to using a transient
 	// in-memory store, which is ideal for testing purposes.
+	cfg := config.Default()
 	sessionManager := scs.New()
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Lifetime = cfg.Session.Lifetime
+	sessionManager.Cookie.Persist = false
 	sessionManager.Cookie.Secure = true
 
 	return &application{
-		errorLog:       log.New(io.Discard, "", 0),
-		infoLog:        log.New(io.Discard, "", 0),
-		snippets:       &mocks.SnippetModel{}, // Use the mock.
-		users:          &mocks.UserModel{},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		logger:             newLogger(io.Discard, "text"),
+		snippets:           &mocks.SnippetModel{}, // Use the mock.
+		users:              &mocks.UserModel{},
+		sessions:           &mocks.SessionModel{},
+		reports:            &mocks.ReportModel{},
+		auditLog:           &mocks.AuditModel{},
+		tokens:             &mocks.TokenModel{},
+		webhooks:           &mocks.WebhookModel{},
+		webhookClient:      newWebhookClient(true),
+		feeds:              newFeedCache(feedCacheTTL),
+		embedOrigins:       []string{"https://wiki.example.com"},
+		secretScanner:      &validator.SecretScanner{Rules: validator.DefaultSecretRules()},
+		deletionPolicy:     models.DeleteCascade,
+		rememberMeLifetime: cfg.Session.RememberMeLifetime,
+		reauthAfter:        15 * time.Minute,
+		reportThreshold:    3,
+		accountLimiter:     models.NewMemoryLoginLimiter(models.DefaultAccountPolicy),
+		ipLimiter:          models.NewMemoryLoginLimiter(models.DefaultIPPolicy),
+		templateCache:      templateCache,
+		formDecoder:        formDecoder,
+		sessionManager:     sessionManager,
 	}
 }
 
@@ -130,3 +149,45 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body.
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// login logs the test server client in with the given credentials, and
+// returns the CSRF token so that it can be used for subsequent POST requests.
+func (ts *testServer) login(t *testing.T, email, password string) string {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", password)
+	form.Add("csrf_token", csrfToken)
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+	return csrfToken
+}
+
+// do sends a request with the given method and body to the test server. It is
+// meant for the JSON API, so the body is sent as application/json unless
+// another content type is given.
+func (ts *testServer) do(t *testing.T, method, urlPath, body string, contentType ...string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType[0])
+	}
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+	rb, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs.StatusCode, rs.Header, string(rb)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type accountTokenCreateForm struct {
+	Name  string            `form:"name"`
+	Scope models.TokenScope `form:"scope"`
+	// ExpiresDays is the token's lifetime; zero means it never expires.
+	ExpiresDays         int `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+// renderTokens shows the token page with the given form, and the new token if
+// one has just been created.
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form accountTokenCreateForm, newToken string) {
+	tokens, err := app.tokens.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = newToken
+	data.Form = form
+	app.render(w, r, status, "tokens.tmpl", data)
+}
+
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, http.StatusOK, accountTokenCreateForm{Scope: models.ScopeRead, ExpiresDays: 90}, "")
+}
+
+// accountTokenCreatePost creates a token and shows it straight away. It is
+// rendered rather than flashed, so that the token itself never ends up in
+// the session store, and it can't be shown again later.
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountTokenCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.PermittedValue(form.Scope, models.TokenScopes...), "scope", "Please choose a scope")
+	form.CheckField(validator.PermittedValue(form.ExpiresDays, 0, 7, 30, 90, 365), "expires", "This field must equal 0, 7, 30, 90 or 365")
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form, "")
+		return
+	}
+
+	var expires time.Time
+	if form.ExpiresDays > 0 {
+		expires = time.Now().AddDate(0, 0, form.ExpiresDays)
+	}
+	token, err := app.tokens.Insert(app.authenticatedUser(r).ID, form.Name, form.Scope, expires)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "token_create", "name=%q scope=%s", form.Name, form.Scope)
+	w.Header().Set("Cache-Control", "no-store")
+	app.renderTokens(w, r, http.StatusOK, accountTokenCreateForm{Scope: models.ScopeRead, ExpiresDays: 90}, token)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+	err = app.tokens.Delete(id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	app.audit(r, "token_revoke", "token_id=%d", id)
+	app.sessionManager.Put(r.Context(), "flash", "The token has been revoked.")
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
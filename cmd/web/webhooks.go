@@ -0,0 +1,308 @@
+package main
+
+import (
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/validator"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// The webhook worker looks for due deliveries every webhookPollInterval and
+// claims up to webhookBatchSize at a time. They are sent one after another, so
+// that each webhook gets its events in order, and every request gives up after
+// webhookTimeout. A claimed delivery is left alone by other workers for
+// webhookLease, which must cover the whole batch; otherwise another instance
+// could claim the end of the batch again and send it twice.
+const (
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 20
+	webhookTimeout      = 10 * time.Second
+	// A minute to spare is plenty for saving the outcomes.
+	webhookLease = webhookBatchSize*webhookTimeout + time.Minute
+	// webhookLogSize is the number of deliveries shown on a webhook's page.
+	webhookLogSize = 50
+)
+
+// newWebhookClient returns the HTTP client used to send webhooks. Webhook
+// URLs are chosen by users, so unless allowPrivate is set the client refuses
+// to connect to loopback, private, carrier-grade NAT and link-local addresses; otherwise anybody
+// could use webhooks to probe the network the server runs in. Redirects
+// aren't followed for the same reason.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598. net.IP has no
+// method for it, but it isn't reachable from the internet either.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// refusePrivateAddress is a net.Dialer Control function. It runs after the
+// host name has been resolved, so it can't be fooled by DNS.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+// signWebhook returns the value of the X-Snippetbox-Signature header: the
+// HMAC-SHA256 of the body keyed with the webhook's secret, as hex.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookPayload builds the JSON body of an event.
+func webhookPayload(event models.WebhookEvent, data envelope) ([]byte, error) {
+	body := envelope{"event": event, "created": time.Now().UTC()}
+	for key, value := range data {
+		body[key] = value
+	}
+	return json.Marshal(body)
+}
+
+// snippetEvent queues an event about one of the user's snippets for all of
+// their webhooks. Anonymous snippets have nobody to notify. Like audit, a
+// failure is logged rather than failing the request.
+func (app *application) snippetEvent(ctx context.Context, userID int, event models.WebhookEvent, id int) {
+	if userID == 0 {
+		return
+	}
+	// Deleted snippets are gone, so the payload only says which one it was.
+	var snippet any = envelope{"id": id}
+	if event != models.EventSnippetDeleted {
+		s, err := app.snippets.Get(id)
+		if err != nil {
+			app.logger.ErrorContext(ctx, "queueing webhook event", "error", err, "event", event, "snippet_id", id)
+			return
+		}
+		snippet = newAPISnippet(s)
+	}
+	payload, err := webhookPayload(event, envelope{"snippet": snippet})
+	if err == nil {
+		err = app.webhooks.Enqueue(userID, event, payload)
+	}
+	if err != nil {
+		app.logger.ErrorContext(ctx, "queueing webhook event", "error", err, "event", event, "snippet_id", id)
+	}
+}
+
+// runWebhookWorker delivers queued events until ctx is cancelled.
+func (app *application) runWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		err := app.deliverWebhooks(ctx)
+		if err != nil {
+			app.logger.ErrorContext(ctx, "delivering webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWebhooks sends every delivery which is due and saves the outcome.
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	for ctx.Err() == nil {
+		deliveries, err := app.webhooks.Claim(webhookBatchSize, webhookLease)
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			code, err := app.sendWebhook(ctx, d)
+			d.Record(code, err, time.Now().UTC())
+			err = app.webhooks.Save(d)
+			if err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// sendWebhook makes one attempt at a delivery and returns the response code.
+func (app *application) sendWebhook(ctx context.Context, d *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhooks/1.0")
+	req.Header.Set("X-Snippetbox-Event", string(d.Event))
+	req.Header.Set("X-Snippetbox-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Snippetbox-Signature", signWebhook(d.Secret, d.Payload))
+	rs, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rs.Body.Close()
+	// Read (some of) the body so that the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(rs.Body, 64<<10))
+	return rs.StatusCode, nil
+}
+
+type accountWebhookCreateForm struct {
+	URL                 string `form:"url"`
+	validator.Validator `form:"-"`
+}
+
+// validWebhookURL reports whether s is an absolute http or https URL.
+func validWebhookURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form accountWebhookCreateForm) {
+	hooks, err := app.webhooks.ForUser(app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Webhooks = hooks
+	data.Form = form
+	app.render(w, r, status, "webhooks.tmpl", data)
+}
+
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, accountWebhookCreateForm{})
+}
+
+func (app *application) accountWebhookCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form accountWebhookCreateForm
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	form.CheckField(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.URL, 2048), "url", "This field cannot be more than 2048 characters long")
+	form.CheckField(validWebhookURL(form.URL), "url", "This field must be a http or https URL")
+	if !form.Valid() {
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+	id, err := app.webhooks.Insert(app.authenticatedUser(r).ID, form.URL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "webhook_create", "webhook_id=%d url=%q", id, form.URL)
+	app.sessionManager.Put(r.Context(), "flash", "The webhook has been added.")
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// webhookFromParams loads the authenticated user's webhook whose ID is in the
+// :id route parameter. It sends a 404 and returns nil if there is no such
+// webhook, or if it belongs to somebody else.
+func (app *application) webhookFromParams(w http.ResponseWriter, r *http.Request) *models.Webhook {
+	id := readIDParam(r)
+	if id == 0 {
+		app.notFound(w, r)
+		return nil
+	}
+	hook, err := app.webhooks.Get(id, app.authenticatedUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+	return hook
+}
+
+// accountWebhookView shows a webhook's secret and its delivery log.
+func (app *application) accountWebhookView(w http.ResponseWriter, r *http.Request) {
+	hook := app.webhookFromParams(w, r)
+	if hook == nil {
+		return
+	}
+	deliveries, err := app.webhooks.Deliveries(hook.ID, webhookLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data := app.newTemplateData(r)
+	data.Webhook = hook
+	data.WebhookDeliveries = deliveries
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, r, http.StatusOK, "webhook.tmpl", data)
+}
+
+// accountWebhookTestPost queues a test event. It goes through the queue like
+// any other event, so the result shows up in the delivery log.
+func (app *application) accountWebhookTestPost(w http.ResponseWriter, r *http.Request) {
+	hook := app.webhookFromParams(w, r)
+	if hook == nil {
+		return
+	}
+	payload, err := webhookPayload(models.EventWebhookTest, envelope{"webhook": envelope{"id": hook.ID, "url": hook.URL}})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	err = app.webhooks.EnqueueFor(hook.ID, models.EventWebhookTest, payload)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Put(r.Context(), "flash", "A test event has been queued.")
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
+
+func (app *application) accountWebhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	hook := app.webhookFromParams(w, r)
+	if hook == nil {
+		return
+	}
+	err := app.webhooks.Delete(hook.ID, hook.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.audit(r, "webhook_delete", "webhook_id=%d", hook.ID)
+	app.sessionManager.Put(r.Context(), "flash", "The webhook has been deleted.")
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
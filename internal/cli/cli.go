@@ -0,0 +1,284 @@
+// Package cli implements snippetbox, a command-line client for the JSON API.
+// It lives here rather than in cmd/cli so that the tests in cmd/web can run it
+// against the real routes.
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// CLI holds what the commands need from the outside world, so that tests can
+// replace it. A nil HTTPClient means a client with a 30 second timeout.
+type CLI struct {
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+	HTTPClient *http.Client
+
+	config     Config
+	configPath string
+	json       bool
+}
+
+// command is a subcommand. run gets the arguments after the command name.
+type command struct {
+	usage   string
+	summary string
+	run     func(c *CLI, args []string) error
+}
+
+var commands = map[string]command{
+	"configure": {"configure -url URL < token", "Save the server URL and API token", (*CLI).configure},
+	"create":    {"create -t TITLE [-e DAYS] [-confirm-secrets] < content", "Create a snippet", (*CLI).create},
+	"get":       {"get ID", "Show a snippet", (*CLI).get},
+	"list":      {"list", "List the latest snippets", (*CLI).list},
+	"search":    {"search [-page N] QUERY", "Search titles and content", (*CLI).search},
+	"delete":    {"delete ID", "Delete one of your snippets", (*CLI).delete},
+}
+
+// usageError is returned for bad arguments, which exit with ExitUsage. An
+// empty message means the problem has already been reported.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// Run runs the command line in args, without the program name, and returns
+// the exit code.
+func (c *CLI) Run(args []string) int {
+	flags := flag.NewFlagSet("snippetbox", flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	flags.StringVar(&c.configPath, "config", defaultConfigPath(), "Path of the configuration file")
+	flags.BoolVar(&c.json, "json", false, "Print the API's JSON instead of a table")
+	flags.Usage = func() { c.usage(flags) }
+	err := flags.Parse(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if flags.NArg() < 1 {
+		c.usage(flags)
+		return ExitUsage
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(c.Stderr, "snippetbox: unknown command %q\n", name)
+		c.usage(flags)
+		return ExitUsage
+	}
+
+	if name != "configure" {
+		c.config, err = loadConfig(c.configPath)
+		if err != nil {
+			fmt.Fprintln(c.Stderr, "snippetbox:", err)
+			return ExitError
+		}
+	}
+	err = cmd.run(c, flags.Args()[1:])
+	var ue usageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.As(err, &ue):
+		if ue.msg != "" {
+			fmt.Fprintf(c.Stderr, "snippetbox %s: %v\nUsage: snippetbox %s\n", name, err, cmd.usage)
+		}
+		return ExitUsage
+	default:
+		fmt.Fprintf(c.Stderr, "snippetbox %s: %v\n", name, err)
+		return ExitError
+	}
+}
+
+func (c *CLI) usage(flags *flag.FlagSet) {
+	fmt.Fprintln(c.Stderr, "Usage: snippetbox [-config PATH] [-json] <command> [arguments]")
+	fmt.Fprintln(c.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(c.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(c.Stderr, "\nFlags:")
+	flags.PrintDefaults()
+}
+
+// newFlagSet returns a flag set for a subcommand which reports its errors
+// through Run rather than exiting.
+func (c *CLI) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.Stderr)
+	return flags
+}
+
+// Config is what the configure command saves: where the server is, and the
+// personal API token from its /account/tokens page.
+type Config struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// defaultConfigPath is $SNIPPETBOX_CLI_CONFIG, or snippetbox/config.json in the
+// user's configuration directory.
+func defaultConfigPath() string {
+	if path := os.Getenv("SNIPPETBOX_CLI_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "snippetbox.json"
+	}
+	return filepath.Join(dir, "snippetbox", "config.json")
+}
+
+func loadConfig(path string) (Config, error) {
+	var config Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config, fmt.Errorf("%s doesn't exist; run snippetbox configure first", path)
+		}
+		return config, err
+	}
+	err = json.Unmarshal(b, &config)
+	if err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.URL == "" {
+		return config, fmt.Errorf("%s: no server URL; run snippetbox configure first", path)
+	}
+	return config, nil
+}
+
+// saveConfig writes the configuration where only the user can read it, as
+// the token is as good as their password for the API.
+func saveConfig(path string, config Config) error {
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// apiError is an error response from the API. Fields, Errors and Secrets
+// are only set for validation errors.
+type apiError struct {
+	Status  int
+	Message string            `json:"error"`
+	Fields  map[string]string `json:"fields"`
+	Errors  []string          `json:"errors"`
+	Secrets []secretFinding   `json:"secrets"`
+}
+
+type secretFinding struct {
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	Text string `json:"text"`
+}
+
+func (e *apiError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	if b.Len() == 0 {
+		b.WriteString(strings.ToLower(http.StatusText(e.Status)))
+	}
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Fprintf(&b, "\n  %s: %s", field, e.Fields[field])
+	}
+	for _, msg := range e.Errors {
+		fmt.Fprintf(&b, "\n  %s", msg)
+	}
+	for _, s := range e.Secrets {
+		fmt.Fprintf(&b, "\n  line %d (%s): %s", s.Line, s.Rule, s.Text)
+	}
+	return b.String()
+}
+
+// do sends a request to the API and returns the response body. Responses
+// other than 2xx are returned as an *apiError.
+func (c *CLI) do(method, path string, body any) ([]byte, error) {
+	u := strings.TrimRight(c.config.URL, "/") + path
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	rs, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Body.Close()
+	b, err := io.ReadAll(rs.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rs.StatusCode < 200 || rs.StatusCode > 299 {
+		e := &apiError{Status: rs.StatusCode}
+		// Anything which isn't the API's JSON error, like a proxy's error
+		// page, is reported by its status alone.
+		json.Unmarshal(b, e)
+		return nil, e
+	}
+	return b, nil
+}
@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxContentBytes is how much of standard input create reads. The server
+// refuses bodies over a megabyte anyway.
+const maxContentBytes = 1 << 20
+
+// snippet is a snippet as the API sends it.
+type snippet struct {
+	ID      int       `json:"id"`
+	UserID  int       `json:"user_id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+type metadata struct {
+	CurrentPage  int `json:"current_page"`
+	PageSize     int `json:"page_size"`
+	LastPage     int `json:"last_page"`
+	TotalRecords int `json:"total_records"`
+}
+
+// parseFlags parses a subcommand's flags. The flag package has already
+// reported any problem, so Run doesn't need to repeat it.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return usageError{}
+	}
+	return err
+}
+
+// readID reads the snippet ID, which must be the only argument.
+func readID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, usagef("want exactly one snippet ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, usagef("invalid snippet ID %q", args[0])
+	}
+	return id, nil
+}
+
+// configure saves the server URL and reads the token from standard input, so
+// that it doesn't end up in the shell's history. Without a token, only the
+// read commands work.
+func (c *CLI) configure(args []string) error {
+	flags := c.newFlagSet("configure")
+	serverURL := flags.String("url", "", "Address of the Snippetbox server, like https://snippetbox.example.com")
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(*serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return usagef("-url must be a http or https URL")
+	}
+	token, err := io.ReadAll(io.LimitReader(c.Stdin, 4096))
+	if err != nil {
+		return err
+	}
+	config := Config{URL: strings.TrimRight(*serverURL, "/"), Token: strings.TrimSpace(string(token))}
+	err = saveConfig(c.configPath, config)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Stdout, "Saved the configuration to %s\n", c.configPath)
+	return nil
+}
+
+// create makes a snippet from standard input.
+func (c *CLI) create(args []string) error {
+	flags := c.newFlagSet("create")
+	title := flags.String("t", "", "Title of the snippet")
+	expires := flags.Int("e", 365, "Days until the snippet expires: 1, 7 or 365")
+	confirm := flags.Bool("confirm-secrets", false, "Publish the snippet even if it looks like it contains secrets")
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return usagef("the content is read from standard input, not the arguments")
+	}
+	content, err := io.ReadAll(io.LimitReader(c.Stdin, maxContentBytes))
+	if err != nil {
+		return err
+	}
+	input := map[string]any{
+		"title":           *title,
+		"content":         string(content),
+		"expires":         *expires,
+		"confirm_secrets": *confirm,
+	}
+	body, err := c.do(http.MethodPost, "/api/v1/snippets", input)
+	if err != nil {
+		return err
+	}
+	return c.printSnippet(body)
+}
+
+func (c *CLI) get(args []string) error {
+	id, err := readID(args)
+	if err != nil {
+		return err
+	}
+	body, err := c.do(http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil)
+	if err != nil {
+		return err
+	}
+	return c.printSnippet(body)
+}
+
+func (c *CLI) list(args []string) error {
+	if len(args) > 0 {
+		return usagef("list takes no arguments")
+	}
+	body, err := c.do(http.MethodGet, "/api/v1/snippets", nil)
+	if err != nil {
+		return err
+	}
+	return c.printSnippets(body)
+}
+
+func (c *CLI) search(args []string) error {
+	flags := c.newFlagSet("search")
+	page := flags.Int("page", 1, "Page of results to show")
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return usagef("missing search query")
+	}
+	if *page < 1 {
+		return usagef("-page must be at least 1")
+	}
+	qs := url.Values{"q": {strings.Join(flags.Args(), " ")}, "page": {strconv.Itoa(*page)}}
+	body, err := c.do(http.MethodGet, "/api/v1/snippets?"+qs.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return c.printSnippets(body)
+}
+
+func (c *CLI) delete(args []string) error {
+	id, err := readID(args)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodDelete, fmt.Sprintf("/api/v1/snippets/%d", id), nil)
+	if err != nil {
+		return err
+	}
+	if !c.json {
+		fmt.Fprintf(c.Stdout, "Deleted snippet %d\n", id)
+	}
+	return nil
+}
+
+// printJSON copies the API's response to standard output as it is.
+func (c *CLI) printJSON(body []byte) error {
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		body = append(body, '\n')
+	}
+	_, err := c.Stdout.Write(body)
+	return err
+}
+
+// printSnippet prints a response with one snippet: a few lines about it, a
+// blank line and the content.
+func (c *CLI) printSnippet(body []byte) error {
+	if c.json {
+		return c.printJSON(body)
+	}
+	var rs struct {
+		Snippet snippet `json:"snippet"`
+	}
+	err := json.Unmarshal(body, &rs)
+	if err != nil {
+		return err
+	}
+	s := rs.Snippet
+	tw := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%d\n", s.ID)
+	fmt.Fprintf(tw, "Title:\t%s\n", s.Title)
+	fmt.Fprintf(tw, "Created:\t%s\n", formatTime(s.Created))
+	fmt.Fprintf(tw, "Expires:\t%s\n", formatTime(s.Expires))
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	content := strings.TrimRight(s.Content, "\n")
+	_, err = fmt.Fprintf(c.Stdout, "\n%s\n", content)
+	return err
+}
+
+// printSnippets prints a response with a list of snippets as a table, with
+// the page numbers underneath if they were sent.
+func (c *CLI) printSnippets(body []byte) error {
+	if c.json {
+		return c.printJSON(body)
+	}
+	var rs struct {
+		Snippets []snippet `json:"snippets"`
+		Metadata *metadata `json:"metadata"`
+	}
+	err := json.Unmarshal(body, &rs)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tCREATED\tEXPIRES")
+	for _, s := range rs.Snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.ID, s.Title, formatTime(s.Created), formatTime(s.Expires))
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	if m := rs.Metadata; m != nil && m.TotalRecords > 0 {
+		_, err = fmt.Fprintf(c.Stdout, "\nPage %d of %d (%d snippets)\n", m.CurrentPage, m.LastPage, m.TotalRecords)
+	}
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
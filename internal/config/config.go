@@ -0,0 +1,407 @@
+// Package config reads the settings of snippetbox. cmd/web uses all of them,
+// and cmd/admin the database ones, from the same configuration file and
+// environment variables, so that both talk to the same database.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"GoWebPractice/internal/models"
+	"GoWebPractice/internal/storage"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the web server. Each one comes from, in
+// increasing order of precedence: its default in Default, the YAML file given
+// by -config or $SNIPPETBOX_CONFIG, an environment variable named after its
+// flag (SNIPPETBOX_DB_DRIVER for -db-driver), and the flag itself. See
+// config.example.yaml for the layout of the file.
+type Config struct {
+	Addr  string `yaml:"addr"`
+	Debug bool   `yaml:"debug"`
+	// LogFormat is text or json.
+	LogFormat string `yaml:"log_format"`
+	DB        struct {
+		// Driver is mysql, postgres, sqlite or memory. An empty DSN is
+		// replaced by storage.DefaultDSN(Driver).
+		Driver string `yaml:"driver"`
+		DSN    string `yaml:"dsn"`
+		// Apply any new schema migrations before serving. SQLite databases
+		// are always migrated.
+		Migrate bool `yaml:"migrate"`
+	} `yaml:"db"`
+	TLS struct {
+		CertFile string `yaml:"cert_file"`
+		KeyFile  string `yaml:"key_file"`
+		// Curves are the names of the elliptic curves to offer, most
+		// preferred first (see CurveIDs).
+		Curves StringList `yaml:"curves"`
+	} `yaml:"tls"`
+	Server struct {
+		IdleTimeout    time.Duration `yaml:"idle_timeout"`
+		ReadTimeout    time.Duration `yaml:"read_timeout"`
+		WriteTimeout   time.Duration `yaml:"write_timeout"`
+		MaxHeaderBytes int           `yaml:"max_header_bytes"`
+		// On SIGINT or SIGTERM, /ready fails for DrainDelay before the
+		// server stops accepting connections, and then the requests in
+		// flight and the background workers get ShutdownTimeout to finish.
+		DrainDelay      time.Duration `yaml:"drain_delay"`
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	} `yaml:"server"`
+	Session struct {
+		Lifetime           time.Duration `yaml:"lifetime"`
+		RememberMeLifetime time.Duration `yaml:"remember_me_lifetime"`
+		ReauthAfter        time.Duration `yaml:"reauth_after"`
+	} `yaml:"session"`
+	LoginLimiter    string     `yaml:"login_limiter"`
+	TrustedProxies  StringList `yaml:"trusted_proxies"` // see Proxies
+	DeletePolicy    string     `yaml:"delete_policy"`
+	ReportThreshold int        `yaml:"report_threshold"`
+	SecretRules     string     `yaml:"secret_rules"`
+	EmbedOrigins    StringList `yaml:"embed_origins"`
+	Webhooks        struct {
+		AllowPrivate bool `yaml:"allow_private"`
+	} `yaml:"webhooks"`
+}
+
+// By default, ordinary sessions expire after sessionLifetime. Users who tick
+// "remember me" on the login form stay logged in for rememberMeLifetime
+// instead.
+const (
+	sessionLifetime    = 12 * time.Hour
+	rememberMeLifetime = 30 * 24 * time.Hour
+)
+
+// Default returns the configuration used when nothing else is given.
+func Default() Config {
+	var cfg Config
+	cfg.Addr = ":4000"
+	cfg.LogFormat = "text"
+	cfg.DB.Driver = "mysql"
+	cfg.TLS.CertFile = "./tls/cert.pem"
+	cfg.TLS.KeyFile = "./tls/key.pem"
+	// Only elliptic curves with assembly implementations.
+	cfg.TLS.Curves = StringList{"X25519", "P256"}
+	cfg.Server.IdleTimeout = time.Minute
+	cfg.Server.ReadTimeout = 5 * time.Second
+	cfg.Server.WriteTimeout = 10 * time.Second
+	cfg.Server.MaxHeaderBytes = 524288
+	cfg.Server.DrainDelay = 5 * time.Second
+	cfg.Server.ShutdownTimeout = 30 * time.Second
+	cfg.Session.Lifetime = sessionLifetime
+	cfg.Session.RememberMeLifetime = rememberMeLifetime
+	cfg.Session.ReauthAfter = 15 * time.Minute
+	cfg.LoginLimiter = "db"
+	cfg.DeletePolicy = string(models.DeleteCascade)
+	cfg.ReportThreshold = 3
+	return cfg
+}
+
+// Flags defines a flag for every setting, which writes into cfg.
+func (cfg *Config) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "HTTP network address")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable debug mode")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log output format (text|json)")
+	cfg.DBFlags(fs)
+	fs.BoolVar(&cfg.DB.Migrate, "migrate", cfg.DB.Migrate, "Apply pending schema migrations on startup")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", cfg.TLS.CertFile, "Path of the TLS certificate")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", cfg.TLS.KeyFile, "Path of the TLS private key")
+	fs.TextVar(&cfg.TLS.Curves, "tls-curves", cfg.TLS.Curves, "Comma-separated elliptic curves to offer, most preferred first (X25519|P256|P384|P521)")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "How long to keep idle keep-alive connections open")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "How long to wait for a whole request")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "How long to take over writing a response")
+	fs.IntVar(&cfg.Server.MaxHeaderBytes, "max-header-bytes", cfg.Server.MaxHeaderBytes, "Largest request header accepted, in bytes")
+	fs.DurationVar(&cfg.Server.DrainDelay, "drain-delay", cfg.Server.DrainDelay, "How long /ready fails before shutting down")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "How long to wait for requests and background work to finish when shutting down")
+	fs.DurationVar(&cfg.Session.Lifetime, "session-lifetime", cfg.Session.Lifetime, "How long a login lasts")
+	fs.DurationVar(&cfg.Session.RememberMeLifetime, "remember-me-lifetime", cfg.Session.RememberMeLifetime, `How long a "remember me" login lasts`)
+	fs.DurationVar(&cfg.Session.ReauthAfter, "reauth-after", cfg.Session.ReauthAfter, "Ask for the password again before sensitive actions after this long")
+	fs.StringVar(&cfg.LoginLimiter, "login-limiter", cfg.LoginLimiter, "Where to track failed logins (db|memory)")
+	fs.TextVar(&cfg.TrustedProxies, "trusted-proxies", cfg.TrustedProxies, "Comma-separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For is believed")
+	fs.StringVar(&cfg.DeletePolicy, "delete-policy", cfg.DeletePolicy, "What happens to a deleted user's snippets (cascade|anonymise)")
+	fs.IntVar(&cfg.ReportThreshold, "report-threshold", cfg.ReportThreshold, "Hide snippets with this many open abuse reports from logged-in users (0 to disable)")
+	fs.StringVar(&cfg.SecretRules, "secret-rules", cfg.SecretRules, "Path to a JSON file of secret scanning rules")
+	fs.TextVar(&cfg.EmbedOrigins, "embed-origins", cfg.EmbedOrigins, "Comma-separated origins which may embed snippets, like https://wiki.example.com")
+	fs.BoolVar(&cfg.Webhooks.AllowPrivate, "webhook-allow-private", cfg.Webhooks.AllowPrivate, "Allow webhooks to loopback and private network addresses")
+}
+
+// DBFlags defines the flags which choose the database, for tools which need
+// nothing else.
+func (cfg *Config) DBFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.DB.Driver, "db-driver", cfg.DB.Driver, "Where to store data (mysql|postgres|sqlite|memory)")
+	fs.StringVar(&cfg.DB.DSN, "dsn", cfg.DB.DSN, "Data source name: a MySQL DSN, a Postgres URL, or the path of the SQLite database")
+}
+
+// envPrefix is the prefix of the environment variables which set flags.
+const envPrefix = "SNIPPETBOX_"
+
+// envName returns the environment variable for a flag: SNIPPETBOX_DB_DRIVER
+// for db-driver.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Load works out the configuration from the command-line arguments (without
+// the program name) and the environment. The caller defines the flags which
+// it accepts on fs, writing into cfg with Flags or DBFlags, and Load adds
+// -config. Every setting can come from the file and the environment, whether
+// or not it has a flag on fs. For -help the error is flag.ErrHelp. Arguments
+// after the flags are left in fs.Args.
+func (cfg *Config) Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) error {
+	configPath, _ := lookupEnv(envPrefix + "CONFIG")
+	fs.StringVar(&configPath, "config", configPath, "Path of a YAML configuration file")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// The flags have been written into cfg already, so remember them before
+	// the file and the environment overwrite them, and then put them back.
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+	if configPath != "" {
+		err = cfg.loadFile(configPath)
+		if err != nil {
+			return err
+		}
+	}
+	// The environment variables are looked up through a set of every
+	// setting's flags, so that they work for settings which fs leaves out,
+	// and not for flags like -print-config which aren't settings.
+	settings := flag.NewFlagSet("", flag.ContinueOnError)
+	cfg.Flags(settings)
+	settings.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		if v, ok := lookupEnv(envName(f.Name)); ok {
+			if setErr := f.Value.Set(v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", v, envName(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for name, v := range given {
+		err = fs.Set(name, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.DB.DSN == "" {
+		cfg.DB.DSN = storage.DefaultDSN(cfg.DB.Driver)
+	}
+	return cfg.validate()
+}
+
+// loadFile reads settings from a YAML file. Settings which it leaves out keep
+// their current values, and unknown ones are an error, so that typos don't go
+// unnoticed.
+func (cfg *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// validate checks that the settings make sense together, and reports every
+// problem at once.
+func (cfg *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(cfg.Addr != "", "addr must not be empty")
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "unknown log format %q", cfg.LogFormat)
+	switch cfg.DB.Driver {
+	case "mysql", "postgres", "sqlite", "memory":
+	default:
+		check(false, "unknown db driver %q", cfg.DB.Driver)
+	}
+	check(cfg.TLS.CertFile != "" && cfg.TLS.KeyFile != "", "tls cert and key files must be given")
+	_, err := cfg.CurveIDs()
+	check(err == nil, "%v", err)
+	check(cfg.Server.IdleTimeout > 0, "idle timeout must be positive")
+	check(cfg.Server.ReadTimeout > 0, "read timeout must be positive")
+	check(cfg.Server.WriteTimeout > 0, "write timeout must be positive")
+	check(cfg.Server.MaxHeaderBytes > 0, "max header bytes must be positive")
+	check(cfg.Server.DrainDelay >= 0, "drain delay must not be negative")
+	check(cfg.Server.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check(cfg.Session.Lifetime > 0, "session lifetime must be positive")
+	check(cfg.Session.RememberMeLifetime >= cfg.Session.Lifetime, "remember me lifetime must be at least the session lifetime")
+	check(cfg.Session.ReauthAfter >= 0, "reauth after must not be negative")
+	switch cfg.LoginLimiter {
+	case "db", "mysql", "memory":
+	default:
+		check(false, "unknown login limiter %q", cfg.LoginLimiter)
+	}
+	policy := models.DeletionPolicy(cfg.DeletePolicy)
+	check(policy == models.DeleteCascade || policy == models.DeleteAnonymise, "unknown deletion policy %q", cfg.DeletePolicy)
+	check(cfg.ReportThreshold >= 0, "report threshold must not be negative")
+	_, err = cfg.Origins()
+	check(err == nil, "embed origins: %v", err)
+	_, err = cfg.Proxies()
+	check(err == nil, "trusted proxies: %v", err)
+	return errors.Join(errs...)
+}
+
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// CurveIDs returns the TLS curve preferences.
+func (cfg *Config) CurveIDs() ([]tls.CurveID, error) {
+	ids := make([]tls.CurveID, 0, len(cfg.TLS.Curves))
+	for _, name := range cfg.TLS.Curves {
+		id, ok := curves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls curve %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Origins returns the origins which may embed snippets. Each origin must be a
+// scheme and host, like https://wiki.example.com, as that is all
+// frame-ancestors can use.
+func (cfg *Config) Origins() ([]string, error) {
+	var origins []string
+	for _, origin := range cfg.EmbedOrigins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("invalid origin %q: want something like https://wiki.example.com", origin)
+		}
+		origins = append(origins, u.Scheme+"://"+u.Host)
+	}
+	return origins, nil
+}
+
+// Proxies returns the trusted proxies as address ranges. A single address is
+// a range of one.
+func (cfg *Config) Proxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, proxy := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid address or CIDR range %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// redacted returns a copy of the configuration which is safe to print: the
+// password in the DSN is replaced with "xxxxx".
+func (cfg Config) redacted() Config {
+	cfg.DB.DSN = redactDSN(cfg.DB.Driver, cfg.DB.DSN)
+	return cfg
+}
+
+var passwordSetting = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+func redactDSN(driver, dsn string) string {
+	switch driver {
+	case "mysql":
+		c, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "xxxxx"
+		}
+		if c.Passwd != "" {
+			c.Passwd = "xxxxx"
+		}
+		return c.FormatDSN()
+	case "postgres":
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return "xxxxx"
+			}
+			q := u.Query()
+			if q.Has("password") {
+				q.Set("password", "xxxxx")
+				u.RawQuery = q.Encode()
+			}
+			return u.Redacted()
+		}
+		return passwordSetting.ReplaceAllString(dsn, "${1}xxxxx")
+	}
+	return dsn
+}
+
+// Print writes the configuration, with secrets redacted, in the format of
+// the configuration file.
+func (cfg Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err := enc.Encode(cfg.redacted())
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// StringList is a list of strings, written as a YAML sequence in the
+// configuration file and separated by commas in flags and the environment.
+type StringList []string
+
+func (l StringList) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l StringList) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *StringList) UnmarshalText(b []byte) error {
+	*l = nil
+	for _, s := range strings.Split(string(b), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// MarshalYAML writes the list as a sequence rather than with commas.
+func (l StringList) MarshalYAML() (any, error) {
+	return []string(l), nil
+}
@@ -0,0 +1,347 @@
+// Package migrations keeps the database schema as numbered SQL files which are
+// built into the binaries, and applies them in order. The versions which have
+// been applied are recorded in the schema_migrations table.
+//
+// Each database driver has its own directory of migrations under sql, with the
+// same versions in each. Every version has an up and a down file, named like
+// 0001_create_snippets.up.sql. Statements in a file are separated by a
+// semicolon at the end of a line.
+//
+// Databases which were set up by hand before migrations existed are brought
+// under them with "migrate up". Versions 1 to 3 are the schema which used to
+// be in the README, and only create the tables which don't exist yet; the
+// columns which were added to it later come in their own migrations, as the
+// README also told people to add them by hand. On MySQL, which has no ADD
+// COLUMN IF NOT EXISTS, those migrations look in information_schema and skip
+// any column or index which is already there.
+//
+// The statements of this package use ? placeholders, so a Postgres database
+// must be opened with models.OpenPostgres, which rewrites them.
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*/*.sql
+var files embed.FS
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// Status is a migration and when it was applied, which is the zero time if it
+// hasn't been.
+type Status struct {
+	Migration
+	Applied time.Time
+}
+
+// Drivers lists the database drivers which have migrations.
+var Drivers = []string{"mysql", "postgres", "sqlite"}
+
+// lockName is the MySQL named lock, and the key of the Postgres advisory lock,
+// which stops two processes from migrating at the same time, for example when
+// several web servers start together with -migrate. SQLite locks the whole
+// database file instead.
+const lockName = "snippetbox.schema_migrations"
+
+// lockTimeout is how long to wait for another process's migrations to finish.
+const lockTimeout = time.Minute
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER      NOT NULL PRIMARY KEY,
+    name    VARCHAR(255) NOT NULL,
+    applied DATETIME     NOT NULL
+)`
+
+// Postgres has no DATETIME.
+const createTablePostgres = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER      NOT NULL PRIMARY KEY,
+    name    VARCHAR(255) NOT NULL,
+    applied TIMESTAMPTZ  NOT NULL
+)`
+
+// All returns every migration for the driver, oldest first.
+func All(driver string) ([]Migration, error) {
+	if !slices.Contains(Drivers, driver) {
+		return nil, fmt.Errorf("migrations: no migrations for driver %q", driver)
+	}
+	return load(files, path.Join("sql", driver))
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		number, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || !found || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migrations: bad file name %q", entry.Name())
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d has two names, %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = splitStatements(string(b))
+		} else {
+			m.Down = splitStatements(string(b))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migrations: version %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations: version %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// splitStatements splits a file into statements, leaving out comments.
+func splitStatements(sql string) []string {
+	statements := []string{}
+	var stmt strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		if stmt.Len() > 0 || strings.TrimSpace(line) != "" {
+			stmt.WriteString(line)
+			stmt.WriteByte('\n')
+		}
+		if strings.HasSuffix(line, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";"))
+			stmt.Reset()
+		}
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements
+}
+
+// withLock runs fn on a connection which holds the migration lock and has
+// made sure that schema_migrations exists. On SQLite and Postgres, where DDL
+// statements are transactional, fn runs in a transaction which is only
+// committed if it succeeds.
+func withLock(db *sql.DB, driver string, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch driver {
+	case "sqlite":
+		// An immediate transaction takes the write lock straight away, so
+		// that a second process waits here rather than failing half way.
+		_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "ROLLBACK")
+	case "postgres":
+		_, err = conn.ExecContext(ctx, "BEGIN")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "ROLLBACK")
+		// lock_timeout covers advisory locks as well, and the lock is
+		// released when the transaction ends.
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = '%ds'", int(lockTimeout.Seconds())))
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", lockName)
+		if err != nil {
+			return err
+		}
+	default:
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return errors.New("migrations: timed out waiting for another migration to finish")
+		}
+		defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+	}
+
+	create := createTable
+	if driver == "postgres" {
+		create = createTablePostgres
+	}
+	_, err = conn.ExecContext(ctx, create)
+	if err != nil {
+		return err
+	}
+	err = fn(conn)
+	if err != nil {
+		return err
+	}
+	if driver == "sqlite" || driver == "postgres" {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+	}
+	return err
+}
+
+// applied returns the applied versions and when they were applied.
+func applied(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, applied FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		err = rows.Scan(&version, &at)
+		if err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+	return versions, rows.Err()
+}
+
+// run executes the statements of one migration. MySQL commits DDL statements
+// as it goes, so a migration which fails half way can't be rolled back there;
+// the error says which one it was, and the version isn't recorded.
+func run(conn *sql.Conn, m Migration, direction string, statements []string) error {
+	for _, stmt := range statements {
+		_, err := conn.ExecContext(context.Background(), stmt)
+		if err != nil {
+			return fmt.Errorf("migrations: %04d_%s %s: %w", m.Version, m.Name, direction, err)
+		}
+	}
+	return nil
+}
+
+// Up applies every migration which hasn't been applied yet, oldest first, and
+// returns the ones it applied. The driver is the name db was opened with.
+func Up(db *sql.DB, driver string) ([]Migration, error) {
+	migrations, err := All(driver)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = withLock(db, driver, func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			err = run(conn, m, "up", m.Up)
+			if err != nil {
+				return err
+			}
+			_, err = conn.ExecContext(context.Background(),
+				"INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)",
+				m.Version, m.Name, time.Now().UTC().Truncate(time.Second))
+			if err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// the ones it reverted. Reverting a migration drops the data in its tables.
+func Down(db *sql.DB, driver string, steps int) ([]Migration, error) {
+	migrations, err := All(driver)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = withLock(db, driver, func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := versions[m.Version]; !ok {
+				continue
+			}
+			err = run(conn, m, "down", m.Down)
+			if err != nil {
+				return err
+			}
+			_, err = conn.ExecContext(context.Background(), "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+			if err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Statuses returns every migration with the time it was applied.
+func Statuses(db *sql.DB, driver string) ([]Status, error) {
+	migrations, err := All(driver)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	err = withLock(db, driver, func(conn *sql.Conn) error {
+		versions, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			statuses = append(statuses, Status{Migration: m, Applied: versions[m.Version]})
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,134 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"GoWebPractice/internal/assert"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestAll(t *testing.T) {
+	var names []string
+	for _, driver := range Drivers {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := All(driver)
+			assert.NilError(t, err)
+			if len(migrations) == 0 {
+				t.Fatal("no migrations")
+			}
+			var got []string
+			for _, m := range migrations {
+				got = append(got, m.Name)
+				if len(m.Up) == 0 || len(m.Down) == 0 {
+					t.Errorf("%04d_%s: empty up or down", m.Version, m.Name)
+				}
+				for _, stmt := range append(m.Up, m.Down...) {
+					if strings.HasSuffix(stmt, ";") || strings.HasPrefix(stmt, "--") {
+						t.Errorf("%04d_%s: badly split statement %q", m.Version, m.Name, stmt)
+					}
+				}
+			}
+			// Every driver has the same versions, so that the schema
+			// version means the same thing whichever database is used.
+			if names == nil {
+				names = got
+			} else if !reflect.DeepEqual(got, names) {
+				t.Errorf("got migrations %q; want %q", got, names)
+			}
+		})
+	}
+
+	_, err := All("oracle")
+	if err == nil {
+		t.Error("got nil; want an error for an unknown driver")
+	}
+}
+
+// TestSQLite applies and reverts the SQLite migrations. The MySQL and
+// Postgres ones are exercised by the integration tests in internal/models.
+func TestSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	assert.NilError(t, err)
+	defer db.Close()
+
+	all, err := All("sqlite")
+	assert.NilError(t, err)
+	applied, err := Up(db, "sqlite")
+	assert.NilError(t, err)
+	assert.Equal(t, len(applied), len(all))
+	applied, err = Up(db, "sqlite")
+	assert.NilError(t, err)
+	assert.Equal(t, len(applied), 0)
+
+	_, err = db.Exec("INSERT INTO audit_log (event, details, ip, user_agent, created, prev_hash, hash) VALUES ('e', '', '', '', '2024-01-01', '', '')")
+	assert.NilError(t, err)
+	_, err = db.Exec("DELETE FROM audit_log")
+	if err == nil || !strings.Contains(err.Error(), "append-only") {
+		t.Errorf("got %v; want the audit log to refuse deletes", err)
+	}
+
+	reverted, err := Down(db, "sqlite", 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(reverted), 1)
+	statuses, err := Statuses(db, "sqlite")
+	assert.NilError(t, err)
+	assert.Equal(t, statuses[len(statuses)-1].Applied.IsZero(), true)
+	assert.Equal(t, statuses[0].Applied.IsZero(), false)
+
+	_, err = Down(db, "sqlite", len(all))
+	assert.NilError(t, err)
+	var tables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").Scan(&tables)
+	assert.NilError(t, err)
+	assert.Equal(t, tables, 0)
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- A comment; with a semicolon.
+CREATE TABLE t
+(
+    id INTEGER NOT NULL
+);
+
+INSERT INTO t VALUES (1);
+INSERT INTO t VALUES (2)`
+	want := []string{
+		"CREATE TABLE t\n(\n    id INTEGER NOT NULL\n)",
+		"INSERT INTO t VALUES (1)",
+		"INSERT INTO t VALUES (2)",
+	}
+	got := splitStatements(sql)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr string
+	}{
+		{name: "Bad name", files: fstest.MapFS{"sql/create.up.sql": file}, wantErr: "bad file name"},
+		{name: "Bad direction", files: fstest.MapFS{"sql/0001_a.sideways.sql": file}, wantErr: "bad file name"},
+		{name: "No down", files: fstest.MapFS{"sql/0001_a.up.sql": file}, wantErr: "needs both"},
+		{name: "Two names", files: fstest.MapFS{"sql/0001_a.up.sql": file, "sql/0001_b.down.sql": file}, wantErr: "two names"},
+		{name: "Gap", files: fstest.MapFS{"sql/0002_a.up.sql": file, "sql/0002_a.down.sql": file}, wantErr: "version 1 is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files, "sql")
+			if err == nil {
+				t.Fatalf("got nil; want an error containing %q", tt.wantErr)
+			}
+			assert.StringContains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
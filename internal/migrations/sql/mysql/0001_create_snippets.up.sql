@@ -0,0 +1,12 @@
+-- The schema which used to be in the README. Databases which were created by
+-- hand from it are left as they are; the columns added since come in later
+-- migrations.
+CREATE TABLE IF NOT EXISTS snippets
+(
+    id      INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    title   VARCHAR(100) NOT NULL,
+    content TEXT         NOT NULL,
+    created DATETIME     NOT NULL,
+    expires DATETIME     NOT NULL,
+    INDEX idx_snippets_created (created)
+);
@@ -0,0 +1,8 @@
+-- The session store of scs/mysqlstore.
+CREATE TABLE IF NOT EXISTS sessions
+(
+    token  CHAR(43)     NOT NULL PRIMARY KEY,
+    data   BLOB         NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL,
+    INDEX sessions_expiry_idx (expiry)
+);
@@ -0,0 +1,12 @@
+-- The schema which used to be in the README. Databases which were created by
+-- hand from it are left as they are; the columns added since come in later
+-- migrations.
+CREATE TABLE IF NOT EXISTS users
+(
+    id              INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name            VARCHAR(255) NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password CHAR(60)     NOT NULL,
+    created         DATETIME     NOT NULL,
+    CONSTRAINT users_uc_email UNIQUE (email)
+);
@@ -0,0 +1,14 @@
+-- Personal API tokens. Only the SHA-256 hash of each token is stored.
+CREATE TABLE IF NOT EXISTS api_tokens
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id    INTEGER      NOT NULL,
+    name       VARCHAR(100) NOT NULL,
+    scope      VARCHAR(20)  NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    created    DATETIME     NOT NULL,
+    expires    DATETIME     NULL,
+    last_used  DATETIME     NULL,
+    CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash),
+    INDEX idx_api_tokens_user_id (user_id)
+);
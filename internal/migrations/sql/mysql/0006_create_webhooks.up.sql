@@ -0,0 +1,29 @@
+-- Webhooks, and the queue of events waiting to be sent to them. The secret
+-- signs the payloads, so it is stored as it is. Deliveries stay in the table
+-- after they have been sent, as the webhook's delivery log.
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id      INTEGER       NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER       NOT NULL,
+    url     VARCHAR(2048) NOT NULL,
+    secret  CHAR(64)      NOT NULL,
+    created DATETIME      NOT NULL,
+    INDEX idx_webhooks_user_id (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id            INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    webhook_id    INTEGER      NOT NULL,
+    event         VARCHAR(50)  NOT NULL,
+    payload       MEDIUMBLOB   NOT NULL,
+    status        VARCHAR(20)  NOT NULL,
+    attempts      INTEGER      NOT NULL,
+    next_attempt  DATETIME     NOT NULL,
+    response_code INTEGER      NOT NULL,
+    error         VARCHAR(255) NOT NULL,
+    created       DATETIME     NOT NULL,
+    last_attempt  DATETIME     NULL,
+    INDEX idx_webhook_deliveries_due (status, next_attempt),
+    INDEX idx_webhook_deliveries_webhook_id (webhook_id)
+);
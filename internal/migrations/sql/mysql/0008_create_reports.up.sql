@@ -0,0 +1,20 @@
+-- Abuse reports. The reporter is "user:<id>" or "ip:<address>". decision,
+-- moderator_id and resolved are filled in when a moderator deals with the
+-- report. Each reporter can only have one open report of a snippet, so that a
+-- snippet can be reported again after a moderator has dismissed the earlier
+-- reports. MySQL has no partial indexes, so the unique key is over a column
+-- which is NULL once the report is resolved.
+CREATE TABLE IF NOT EXISTS reports
+(
+    id            INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id    INTEGER      NOT NULL,
+    reporter      VARCHAR(255) NOT NULL,
+    reason        VARCHAR(20)  NOT NULL,
+    details       TEXT         NOT NULL,
+    created       DATETIME     NOT NULL,
+    decision      VARCHAR(20)  NULL,
+    moderator_id  INTEGER      NULL,
+    resolved      DATETIME     NULL,
+    open_reporter VARCHAR(255) AS (IF(decision IS NULL, reporter, NULL)) STORED,
+    CONSTRAINT reports_uc_reporter UNIQUE (snippet_id, open_reporter)
+);
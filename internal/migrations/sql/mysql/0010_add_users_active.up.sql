@@ -0,0 +1,12 @@
+-- Deactivated users can't log in, and their snippets are hidden.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'users' AND column_name = 'active') = 0,
+    'ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,24 @@
+-- The owner of a snippet, which is NULL for anonymous snippets.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'user_id') = 0,
+    'ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL AFTER id',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.statistics
+     WHERE table_schema = DATABASE() AND table_name = 'snippets' AND index_name = 'idx_snippets_user_id') = 0,
+    'CREATE INDEX idx_snippets_user_id ON snippets (user_id)',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,13 @@
+-- Roles are 'user', 'moderator' or 'admin'. Create the first admin with
+-- "admin create-user -role admin".
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'users' AND column_name = 'role') = 0,
+    'ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT ''user''',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
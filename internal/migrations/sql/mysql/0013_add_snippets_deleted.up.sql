@@ -0,0 +1,12 @@
+-- When the snippet was soft-deleted by an admin, if it was.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'deleted') = 0,
+    'ALTER TABLE snippets ADD COLUMN deleted DATETIME NULL',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,12 @@
+-- Set when a snippet is hidden by moderation.
+SET @stmt = IF(
+    (SELECT COUNT(*) FROM information_schema.columns
+     WHERE table_schema = DATABASE() AND table_name = 'snippets' AND column_name = 'hidden') = 0,
+    'ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE',
+    'DO 0');
+
+PREPARE stmt FROM @stmt;
+
+EXECUTE stmt;
+
+DEALLOCATE PREPARE stmt;
@@ -0,0 +1,13 @@
+-- The schema which used to be in the README. Databases which were created by
+-- hand from it are left as they are; the columns added since come in later
+-- migrations.
+CREATE TABLE IF NOT EXISTS snippets
+(
+    id      INTEGER      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    title   VARCHAR(100) NOT NULL,
+    content TEXT         NOT NULL,
+    created TIMESTAMPTZ  NOT NULL,
+    expires TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snippets_created ON snippets (created);
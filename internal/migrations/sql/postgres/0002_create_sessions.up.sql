@@ -0,0 +1,9 @@
+-- The session store of scs/postgresstore.
+CREATE TABLE IF NOT EXISTS sessions
+(
+    token  TEXT        NOT NULL PRIMARY KEY,
+    data   BYTEA       NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
@@ -0,0 +1,19 @@
+-- One row per login, so that users can see and revoke their sessions. token is
+-- that of the scs session, so that a user's sessions can be destroyed without
+-- reading every session in the store, and the row expires with the session
+-- data, so that expired sessions aren't listed forever and can be deleted.
+CREATE TABLE IF NOT EXISTS user_sessions
+(
+    id         CHAR(43)     NOT NULL PRIMARY KEY,
+    user_id    INTEGER      NOT NULL,
+    token      TEXT         NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    created    TIMESTAMPTZ  NOT NULL,
+    last_seen  TIMESTAMPTZ  NOT NULL,
+    expires    TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires ON user_sessions (expires);
@@ -0,0 +1,15 @@
+-- Personal API tokens. Only the SHA-256 hash of each token is stored.
+CREATE TABLE IF NOT EXISTS api_tokens
+(
+    id         INTEGER      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id    INTEGER      NOT NULL,
+    name       VARCHAR(100) NOT NULL,
+    scope      VARCHAR(20)  NOT NULL,
+    token_hash CHAR(64)     NOT NULL,
+    created    TIMESTAMPTZ  NOT NULL,
+    expires    TIMESTAMPTZ  NULL,
+    last_used  TIMESTAMPTZ  NULL,
+    CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
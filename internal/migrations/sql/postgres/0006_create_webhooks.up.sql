@@ -0,0 +1,32 @@
+-- Webhooks, and the queue of events waiting to be sent to them. The secret
+-- signs the payloads, so it is stored as it is. Deliveries stay in the table
+-- after they have been sent, as the webhook's delivery log.
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id      INTEGER       GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id INTEGER       NOT NULL,
+    url     VARCHAR(2048) NOT NULL,
+    secret  CHAR(64)      NOT NULL,
+    created TIMESTAMPTZ   NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id            INTEGER      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    webhook_id    INTEGER      NOT NULL,
+    event         VARCHAR(50)  NOT NULL,
+    payload       BYTEA        NOT NULL,
+    status        VARCHAR(20)  NOT NULL,
+    attempts      INTEGER      NOT NULL,
+    next_attempt  TIMESTAMPTZ  NOT NULL,
+    response_code INTEGER      NOT NULL,
+    error         VARCHAR(255) NOT NULL,
+    created       TIMESTAMPTZ  NOT NULL,
+    last_attempt  TIMESTAMPTZ  NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
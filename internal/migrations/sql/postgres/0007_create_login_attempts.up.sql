@@ -0,0 +1,8 @@
+-- Failed login attempts, keyed by "account:<email>" or "ip:<address>".
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    attempt_key  VARCHAR(255) NOT NULL PRIMARY KEY,
+    failures     INTEGER      NOT NULL,
+    last_failure TIMESTAMPTZ  NOT NULL,
+    locked_until TIMESTAMPTZ  NOT NULL
+);
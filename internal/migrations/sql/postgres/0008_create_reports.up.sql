@@ -0,0 +1,19 @@
+-- Abuse reports. The reporter is "user:<id>" or "ip:<address>". decision,
+-- moderator_id and resolved are filled in when a moderator deals with the
+-- report. Each reporter can only have one open report of a snippet, so that a
+-- snippet can be reported again after a moderator has dismissed the earlier
+-- reports.
+CREATE TABLE IF NOT EXISTS reports
+(
+    id           INTEGER      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    snippet_id   INTEGER      NOT NULL,
+    reporter     VARCHAR(255) NOT NULL,
+    reason       VARCHAR(20)  NOT NULL,
+    details      TEXT         NOT NULL,
+    created      TIMESTAMPTZ  NOT NULL,
+    decision     VARCHAR(20)  NULL,
+    moderator_id INTEGER      NULL,
+    resolved     TIMESTAMPTZ  NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS reports_uc_reporter ON reports (snippet_id, reporter) WHERE decision IS NULL;
@@ -0,0 +1,26 @@
+-- Append-only audit log. Each row's hash covers its contents and the hash of
+-- the row before it (see models.AuditEntry.ComputeHash), so edits and
+-- deletions can be detected with "Verify chain" on /admin/audit. The triggers
+-- stop the application from rewriting history.
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         INTEGER      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    actor_id   INTEGER      NULL,
+    event      VARCHAR(50)  NOT NULL,
+    details    TEXT         NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created    TIMESTAMPTZ  NOT NULL,
+    prev_hash  CHAR(64)     NOT NULL,
+    hash       CHAR(64)     NOT NULL
+);
+
+-- Postgres has no CREATE TRIGGER IF NOT EXISTS, so the triggers are
+-- replaced instead.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN RAISE EXCEPTION 'audit_log is append-only'; END $$;
+
+CREATE OR REPLACE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE OR REPLACE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
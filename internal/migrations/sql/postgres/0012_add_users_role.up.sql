@@ -0,0 +1,3 @@
+-- Roles are 'user', 'moderator' or 'admin'. Create the first admin with
+-- "admin create-user -role admin".
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
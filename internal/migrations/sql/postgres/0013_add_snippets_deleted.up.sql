@@ -0,0 +1,2 @@
+-- When the snippet was soft-deleted by an admin, if it was.
+ALTER TABLE snippets ADD COLUMN deleted TIMESTAMPTZ NULL;
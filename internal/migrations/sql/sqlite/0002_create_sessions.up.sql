@@ -0,0 +1,9 @@
+-- The session store of scs/sqlite3store. The expiry is a Julian day number.
+CREATE TABLE IF NOT EXISTS sessions
+(
+    token  TEXT NOT NULL PRIMARY KEY,
+    data   BLOB NOT NULL,
+    expiry REAL NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_expiry_idx ON sessions (expiry);
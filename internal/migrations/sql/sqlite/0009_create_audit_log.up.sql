@@ -0,0 +1,22 @@
+-- Append-only audit log. Each row's hash covers its contents and the hash of
+-- the row before it (see models.AuditEntry.ComputeHash), so edits and
+-- deletions can be detected with "Verify chain" on /admin/audit. The triggers
+-- stop the application from rewriting history.
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    actor_id   INTEGER      NULL,
+    event      VARCHAR(50)  NOT NULL,
+    details    TEXT         NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created    DATETIME     NOT NULL,
+    prev_hash  CHAR(64)     NOT NULL,
+    hash       CHAR(64)     NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
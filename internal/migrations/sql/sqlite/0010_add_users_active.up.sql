@@ -0,0 +1,2 @@
+-- Deactivated users can't log in, and their snippets are hidden.
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,4 @@
+-- The owner of a snippet, which is NULL for anonymous snippets.
+ALTER TABLE snippets ADD COLUMN user_id INTEGER NULL;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_user_id ON snippets (user_id);
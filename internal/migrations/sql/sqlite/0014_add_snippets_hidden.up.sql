@@ -0,0 +1,2 @@
+-- Set when a snippet is hidden by moderation.
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
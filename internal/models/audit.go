@@ -0,0 +1,276 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The audit log is append-only: the application never updates or deletes
+// entries, and each entry includes the hash of the one before it, so that
+// editing or removing an entry afterwards breaks the chain from that point
+// on. Verify walks the chain to check it.
+type AuditModelInterface interface {
+	Insert(e *AuditEntry) error
+	List(f Filter) ([]*AuditEntry, Metadata, error)
+	Each(fn func(*AuditEntry) error) error
+	Verify() (int, error)
+}
+
+// AuditEntry is a single security-relevant event. ActorID is zero when
+// nobody was logged in, for example for a failed login.
+type AuditEntry struct {
+	ID        int
+	ActorID   int
+	Event     string
+	Details   string
+	IP        string
+	UserAgent string
+	Created   time.Time
+	PrevHash  string
+	Hash      string
+}
+
+// ComputeHash returns the hash of the entry chained to the previous one. The
+// fields are encoded as a JSON array so that no two different entries can
+// produce the same input.
+func (e *AuditEntry) ComputeHash() string {
+	b, _ := json.Marshal([]any{e.PrevHash, e.ActorID, e.Event, e.Details, e.IP, e.UserAgent, e.Created.UTC().Format(time.RFC3339)})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditLockTimeout is how long Insert waits for another instance of the
+// application to finish appending.
+const auditLockTimeout = 10
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Insert appends an entry to the log, filling in its ID, creation time and
+// hashes. A MySQL named lock (on SQLite an immediate transaction, and on
+// Postgres a transaction holding an advisory lock) makes sure that concurrent
+// inserts, even from different instances of the application, chain onto each
+// other rather than onto the same predecessor.
+func (m *AuditModel) Insert(e *AuditEntry) error {
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	d := dialectOf(m.DB)
+	switch d {
+	case dialectSQLite:
+		_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "ROLLBACK")
+	case dialectPostgres:
+		_, err = conn.ExecContext(ctx, "BEGIN")
+		if err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "ROLLBACK")
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("SET LOCAL lock_timeout = '%ds'", auditLockTimeout))
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('audit_log'))")
+		if err != nil {
+			return err
+		}
+	default:
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK('audit_log', ?)", auditLockTimeout).Scan(&locked)
+		if err != nil {
+			return err
+		}
+		if locked.Int64 != 1 {
+			return errors.New("models: timed out waiting for the audit log lock")
+		}
+		defer conn.ExecContext(ctx, "DO RELEASE_LOCK('audit_log')")
+	}
+
+	var prevHash string
+	err = conn.QueryRowContext(ctx, "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	e.UserAgent = truncate(e.UserAgent, 255)
+	// DATETIME columns only store whole seconds, so truncate before hashing.
+	e.Created = now()
+	e.PrevHash = prevHash
+	e.Hash = e.ComputeHash()
+
+	stmt := `INSERT INTO audit_log (actor_id, event, details, ip, user_agent, created, prev_hash, hash)
+	VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)`
+	id, err := insertID(ctx, d, conn, stmt, e.ActorID, e.Event, e.Details, e.IP, e.UserAgent, e.Created, e.PrevHash, e.Hash)
+	if err != nil {
+		return err
+	}
+	if d != dialectMySQL {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+		if err != nil {
+			return err
+		}
+	}
+	e.ID = id
+	return nil
+}
+
+const auditColumns = "id, COALESCE(actor_id, 0), event, details, ip, user_agent, created, prev_hash, hash"
+
+func scanAuditEntry(rows *sql.Rows) (*AuditEntry, error) {
+	e := &AuditEntry{}
+	err := rows.Scan(&e.ID, &e.ActorID, &e.Event, &e.Details, &e.IP, &e.UserAgent, &e.Created, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// List returns the entries whose event name matches the filter, newest first.
+func (m *AuditModel) List(f Filter) ([]*AuditEntry, Metadata, error) {
+	var total int
+	err := m.DB.QueryRow(ilike(m.DB, "SELECT COUNT(*) FROM audit_log WHERE event LIKE ?"), f.likePattern()).Scan(&total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	stmt := "SELECT " + auditColumns + " FROM audit_log WHERE event LIKE ? ORDER BY id DESC LIMIT ? OFFSET ?"
+	rows, err := m.DB.Query(ilike(m.DB, stmt), f.likePattern(), f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return entries, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+// Each calls fn for every entry, oldest first, without loading the whole log
+// into memory. It stops at the first error returned by fn.
+func (m *AuditModel) Each(fn func(*AuditEntry) error) error {
+	rows, err := m.DB.Query("SELECT " + auditColumns + " FROM audit_log ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		err = fn(e)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Verify checks the hash chain and returns the ID of the first entry which
+// doesn't match, or zero if the whole log is intact.
+func (m *AuditModel) Verify() (int, error) {
+	return VerifyAuditChain(m.Each)
+}
+
+// errChainBroken stops VerifyAuditChain once a broken entry has been found.
+var errChainBroken = errors.New("models: audit chain broken")
+
+// VerifyAuditChain walks the entries produced by each, oldest first, and
+// returns the ID of the first one whose hash doesn't match its contents or
+// whose PrevHash doesn't match the entry before it.
+func VerifyAuditChain(each func(func(*AuditEntry) error) error) (int, error) {
+	prevHash := ""
+	brokenID := 0
+	err := each(func(e *AuditEntry) error {
+		if e.PrevHash != prevHash || e.ComputeHash() != e.Hash {
+			brokenID = e.ID
+			return errChainBroken
+		}
+		prevHash = e.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return 0, err
+	}
+	return brokenID, nil
+}
+
+// MemoryAuditModel is AuditModel for a MemoryDB. Nothing can change the
+// entries after they have been appended, but Verify still checks the chain.
+type MemoryAuditModel struct {
+	DB *MemoryDB
+}
+
+func (m *MemoryAuditModel) Insert(e *AuditEntry) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	e.PrevHash = ""
+	if len(m.DB.audit) > 0 {
+		e.PrevHash = m.DB.audit[len(m.DB.audit)-1].Hash
+	}
+	e.UserAgent = truncate(e.UserAgent, 255)
+	e.Created = now()
+	e.Hash = e.ComputeHash()
+	e.ID = m.DB.nextID("audit_log")
+	c := *e
+	m.DB.audit = append(m.DB.audit, &c)
+	return nil
+}
+
+func (m *MemoryAuditModel) List(f Filter) ([]*AuditEntry, Metadata, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var entries []*AuditEntry
+	for i := len(m.DB.audit) - 1; i >= 0; i-- {
+		if e := m.DB.audit[i]; f.matches(e.Event) {
+			c := *e
+			entries = append(entries, &c)
+		}
+	}
+	page, metadata := paginate(entries, f)
+	return page, metadata, nil
+}
+
+// Each calls fn without holding the lock, so that fn can take its time.
+func (m *MemoryAuditModel) Each(fn func(*AuditEntry) error) error {
+	m.DB.mu.Lock()
+	entries := make([]AuditEntry, 0, len(m.DB.audit))
+	for _, e := range m.DB.audit {
+		entries = append(entries, *e)
+	}
+	m.DB.mu.Unlock()
+	for i := range entries {
+		err := fn(&entries[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryAuditModel) Verify() (int, error) {
+	return VerifyAuditChain(m.Each)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"GoWebPractice/internal/assert"
+)
+
+func TestVerifyAuditChain(t *testing.T) {
+	// newChain builds a valid chain of three entries.
+	newChain := func() []*AuditEntry {
+		created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+		var entries []*AuditEntry
+		prevHash := ""
+		for i, event := range []string{"signup", "login_success", "logout"} {
+			e := &AuditEntry{ID: i + 1, ActorID: 1, Event: event, IP: "192.0.2.1", Created: created, PrevHash: prevHash}
+			e.Hash = e.ComputeHash()
+			prevHash = e.Hash
+			entries = append(entries, e)
+		}
+		return entries
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]*AuditEntry) []*AuditEntry
+		want   int
+	}{
+		{
+			name:   "Intact",
+			tamper: func(e []*AuditEntry) []*AuditEntry { return e },
+			want:   0,
+		},
+		{
+			name: "Edited entry",
+			tamper: func(e []*AuditEntry) []*AuditEntry {
+				e[1].ActorID = 2
+				return e
+			},
+			want: 2,
+		},
+		{
+			name: "Deleted entry",
+			tamper: func(e []*AuditEntry) []*AuditEntry {
+				return append(e[:1], e[2:]...)
+			},
+			want: 3,
+		},
+		{
+			name: "Rehashed entry",
+			tamper: func(e []*AuditEntry) []*AuditEntry {
+				e[0].Details = "forged"
+				e[0].Hash = e[0].ComputeHash()
+				return e
+			},
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.tamper(newChain())
+			each := func(fn func(*AuditEntry) error) error {
+				for _, e := range entries {
+					if err := fn(e); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			got, err := VerifyAuditChain(each)
+			assert.NilError(t, err)
+			assert.Equal(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,624 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"GoWebPractice/internal/assert"
+)
+
+// The conformance tests run the same checks against every backend, so that
+// the application behaves in the same way whichever -db-driver it is given.
+// The memory and SQLite backends need nothing installed and always run; MySQL
+// and Postgres are skipped with -short, like the other integration tests, and
+// Postgres also when there is no test database to connect to.
+
+// backend is one implementation of the models.
+type backend struct {
+	snippets SnippetModelInterface
+	users    UserModelInterface
+	sessions SessionModelInterface
+	reports  ReportModelInterface
+	auditLog AuditModelInterface
+	tokens   TokenModelInterface
+	webhooks WebhookModelInterface
+	limiter  func(LoginLimiterPolicy) LoginLimiterInterface
+}
+
+func sqlBackend(db *sql.DB) backend {
+	return backend{
+		snippets: &SnippetModel{DB: db},
+		users:    &UserModel{DB: db},
+		sessions: &SessionModel{DB: db},
+		reports:  &ReportModel{DB: db},
+		auditLog: &AuditModel{DB: db},
+		tokens:   &TokenModel{DB: db},
+		webhooks: &WebhookModel{DB: db},
+		limiter: func(policy LoginLimiterPolicy) LoginLimiterInterface {
+			return &LoginAttemptModel{DB: db, Policy: policy}
+		},
+	}
+}
+
+func memoryBackend(db *MemoryDB) backend {
+	return backend{
+		snippets: &MemorySnippetModel{DB: db},
+		users:    &MemoryUserModel{DB: db},
+		sessions: &MemorySessionModel{DB: db},
+		reports:  &MemoryReportModel{DB: db},
+		auditLog: &MemoryAuditModel{DB: db},
+		tokens:   &MemoryTokenModel{DB: db},
+		webhooks: &MemoryWebhookModel{DB: db},
+		limiter: func(policy LoginLimiterPolicy) LoginLimiterInterface {
+			return NewMemoryLoginLimiter(policy)
+		},
+	}
+}
+
+var backends = []struct {
+	name        string
+	integration bool
+	open        func(t *testing.T) backend
+}{
+	{name: "memory", open: func(t *testing.T) backend { return memoryBackend(newTestMemoryDB(t)) }},
+	{name: "sqlite", open: func(t *testing.T) backend { return sqlBackend(newTestSQLiteDB(t)) }},
+	{name: "mysql", integration: true, open: func(t *testing.T) backend { return sqlBackend(newTestDB(t)) }},
+	{name: "postgres", integration: true, open: func(t *testing.T) backend { return sqlBackend(newTestPostgresDB(t)) }},
+}
+
+// forEachBackend runs fn once for every backend, each time with a new
+// database holding the test users.
+func forEachBackend(t *testing.T, fn func(t *testing.T, b backend)) {
+	for _, bk := range backends {
+		t.Run(bk.name, func(t *testing.T) {
+			if bk.integration && testing.Short() {
+				t.Skip("models: skipping integration test")
+			}
+			fn(t, bk.open(t))
+		})
+	}
+}
+
+// ids returns the IDs of the snippets, for comparing lists of them.
+func ids(snippets []*Snippet) string {
+	var s []int
+	for _, snippet := range snippets {
+		s = append(s, snippet.ID)
+	}
+	return fmt.Sprint(s)
+}
+
+func assertErrorIs(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("got: %v; want: %v", err, target)
+	}
+}
+
+func TestConformanceSnippets(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.snippets
+		id, err := m.Insert(1, "An old silent pond", "A frog jumps into the pond", 7)
+		assert.NilError(t, err)
+		s, err := m.Get(id)
+		assert.NilError(t, err)
+		assert.Equal(t, s.ID, id)
+		assert.Equal(t, s.UserID, 1)
+		assert.Equal(t, s.Title, "An old silent pond")
+		assert.Equal(t, s.Content, "A frog jumps into the pond")
+		assert.Equal(t, s.Expires.Sub(s.Created), 7*24*time.Hour)
+		if d := time.Until(s.Created) - snippetTimeOffset; d < -time.Minute || d > time.Minute {
+			t.Errorf("created %v, which is %v away from now in UTC+8", s.Created, d)
+		}
+		_, err = m.Get(id + 100)
+		assertErrorIs(t, err, ErrNoRecord)
+
+		// Expired snippets, and those of deactivated users, are kept but
+		// not shown.
+		expired, err := m.Insert(1, "Over", "Already expired", -1)
+		assert.NilError(t, err)
+		_, err = m.Get(expired)
+		assertErrorIs(t, err, ErrNoRecord)
+		carols, err := m.Insert(2, "Carol's", "Hidden along with her account", 7)
+		assert.NilError(t, err)
+		_, err = m.Get(carols)
+		assertErrorIs(t, err, ErrNoRecord)
+
+		latest, err := m.Latest()
+		assert.NilError(t, err)
+		assert.Equal(t, ids(latest), fmt.Sprint([]int{id}))
+		latest, err = m.LatestForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, ids(latest), fmt.Sprint([]int{id}))
+		owned, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, ids(owned), fmt.Sprint([]int{id, expired}))
+
+		found, metadata, err := m.Search(Filter{Query: "FROG", Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, ids(found), fmt.Sprint([]int{id}))
+		assert.Equal(t, metadata.TotalRecords, 1)
+		found, _, err = m.Search(Filter{Query: "account", Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(found), 0)
+
+		listed, metadata, err := m.List(Filter{Page: 1, PageSize: 2})
+		assert.NilError(t, err)
+		assert.Equal(t, ids(listed), fmt.Sprint([]int{carols, expired}))
+		assert.Equal(t, metadata, Metadata{CurrentPage: 1, PageSize: 2, LastPage: 2, TotalRecords: 3})
+
+		for _, hide := range []func(int, bool) error{m.SetHidden, m.SetDeleted} {
+			assert.NilError(t, hide(id, true))
+			_, err = m.Get(id)
+			assertErrorIs(t, err, ErrNoRecord)
+			listed, _, err = m.List(Filter{Query: "pond", Page: 1, PageSize: 10})
+			assert.NilError(t, err)
+			assert.Equal(t, len(listed), 1)
+			assert.Equal(t, listed[0].Hidden || listed[0].Deleted, true)
+			assert.NilError(t, hide(id, false))
+			_, err = m.Get(id)
+			assert.NilError(t, err)
+			// Setting the flag it already has changes nothing, but the
+			// snippet is still there.
+			assert.NilError(t, hide(id, false))
+			assertErrorIs(t, hide(id+100, true), ErrNoRecord)
+		}
+
+		err = m.Update(id, "O snail", "Climb Mount Fuji", 1)
+		assert.NilError(t, err)
+		assertErrorIs(t, m.Update(id+100, "O snail", "Climb Mount Fuji", 1), ErrNoRecord)
+		s, err = m.Get(id)
+		assert.NilError(t, err)
+		assert.Equal(t, s.Title, "O snail")
+		assert.Equal(t, s.Content, "Climb Mount Fuji")
+		if d := time.Until(s.Expires) - snippetTimeOffset - 24*time.Hour; d < -time.Minute || d > time.Minute {
+			t.Errorf("expires %v, which is %v away from a day from now in UTC+8", s.Expires, d)
+		}
+
+		owner, err := m.Owner(carols)
+		assert.NilError(t, err)
+		assert.Equal(t, owner, 2)
+		_, err = m.Owner(id + 100)
+		assertErrorIs(t, err, ErrNoRecord)
+
+		n, err := m.DeleteExpired()
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		assert.NilError(t, m.Delete(id))
+		assertErrorIs(t, m.Delete(id), ErrNoRecord)
+		owned, err = m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(owned), 0)
+
+		// The wildcards of LIKE, and its escape character, match only
+		// themselves.
+		sale, err := m.Insert(1, "50% off_everything!", "Sale", 7)
+		assert.NilError(t, err)
+		_, err = m.Insert(1, "Plain", "Nothing special", 7)
+		assert.NilError(t, err)
+		for _, query := range []string{"%", "_", "!", "0% off_"} {
+			found, _, err = m.Search(Filter{Query: query, Page: 1, PageSize: 10})
+			assert.NilError(t, err)
+			assert.Equal(t, ids(found), fmt.Sprint([]int{sale}))
+			listed, _, err = m.List(Filter{Query: query, Page: 1, PageSize: 10})
+			assert.NilError(t, err)
+			assert.Equal(t, ids(listed), fmt.Sprint([]int{sale}))
+		}
+
+		days, err := m.CreatedPerDay(7)
+		assert.NilError(t, err)
+		assert.Equal(t, len(days), 7)
+	})
+}
+
+func TestConformanceUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.users
+		id, err := m.Authenticate("alice2@example.com", "pa$$word")
+		assert.NilError(t, err)
+		assert.Equal(t, id, 1)
+		_, err = m.Authenticate("alice2@example.com", "wrong")
+		assertErrorIs(t, err, ErrInvalidCredentials)
+		_, err = m.Authenticate("nobody@example.com", "pa$$word")
+		assertErrorIs(t, err, ErrInvalidCredentials)
+		_, err = m.Authenticate("carol@example.com", "pa$$word")
+		assertErrorIs(t, err, ErrInactiveAccount)
+
+		for _, tt := range []struct {
+			id   int
+			want bool
+		}{{1, true}, {2, false}, {0, false}, {3, false}} {
+			exists, err := m.Exists(tt.id)
+			assert.NilError(t, err)
+			assert.Equal(t, exists, tt.want)
+		}
+
+		u, err := m.Get(1)
+		assert.NilError(t, err)
+		assert.Equal(t, u.Name, "Alice Jones2")
+		assert.Equal(t, u.Email, "alice2@example.com")
+		assert.Equal(t, u.Created.Equal(testUsersCreated), true)
+		assert.Equal(t, u.Active, true)
+		assert.Equal(t, u.Role, RoleUser)
+		_, err = m.Get(3)
+		assertErrorIs(t, err, ErrNoRecord)
+		u, err = m.GetByEmail("carol@example.com")
+		assert.NilError(t, err)
+		assert.Equal(t, u.ID, 2)
+		assert.Equal(t, u.Active, false)
+
+		assertErrorIs(t, m.Insert("Alice Again", "alice2@example.com", "pa$$word"), ErrDuplicateEmail)
+		assert.NilError(t, m.SetActive(2, true))
+		assert.NilError(t, m.SetRole(2, RoleModerator))
+		u, err = m.Get(2)
+		assert.NilError(t, err)
+		assert.Equal(t, u.Active, true)
+		assert.Equal(t, u.Role, RoleModerator)
+
+		assertErrorIs(t, m.PasswordUpdate(1, "wrong", "new password"), ErrInvalidCredentials)
+		assert.NilError(t, m.CheckPassword(1, "pa$$word"))
+		assertErrorIs(t, m.CheckPassword(1, "wrong"), ErrInvalidCredentials)
+		assertErrorIs(t, m.CheckPassword(3, "pa$$word"), ErrInvalidCredentials)
+		assertErrorIs(t, m.SetPassword(3, "new password"), ErrNoRecord)
+
+		users, metadata, err := m.List(Filter{Query: "CAROL", Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 1)
+		assert.Equal(t, users[0].ID, 2)
+		assert.Equal(t, metadata.TotalRecords, 1)
+		users, _, err = m.List(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(users), 2)
+		assert.Equal(t, users[0].ID, 2)
+
+		days, err := m.SignupsPerDay(7)
+		assert.NilError(t, err)
+		assert.Equal(t, len(days), 7)
+	})
+}
+
+func TestConformanceUserDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		kept, err := b.snippets.Insert(1, "Kept", "Anonymised", 7)
+		assert.NilError(t, err)
+		_, err = b.sessions.Insert(1, "token-1", "Firefox", "192.0.2.1", time.Now().Add(time.Hour))
+		assert.NilError(t, err)
+		_, err = b.tokens.Insert(1, "laptop", ScopeRead, time.Time{})
+		assert.NilError(t, err)
+		hook, err := b.webhooks.Insert(1, "https://example.com/hook")
+		assert.NilError(t, err)
+		assert.NilError(t, b.webhooks.EnqueueFor(hook, EventWebhookTest, []byte("{}")))
+		gone, err := b.snippets.Insert(2, "Gone", "Cascaded", 7)
+		assert.NilError(t, err)
+		_, err = b.reports.Insert(kept, "user:2", ReasonSpam, "")
+		assert.NilError(t, err)
+		_, err = b.reports.Insert(gone, "ip:192.0.2.1", ReasonSpam, "")
+		assert.NilError(t, err)
+
+		assert.NilError(t, b.users.Delete(1, DeleteAnonymise))
+		assert.NilError(t, b.users.Delete(2, DeleteCascade))
+		assertErrorIs(t, b.users.Delete(1, DeleteCascade), ErrNoRecord)
+
+		// An anonymised snippet has no owner, so it stays visible.
+		s, err := b.snippets.Get(kept)
+		assert.NilError(t, err)
+		assert.Equal(t, s.UserID, 0)
+		_, err = b.snippets.Owner(gone)
+		assertErrorIs(t, err, ErrNoRecord)
+		sessions, err := b.sessions.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(sessions), 0)
+		tokens, err := b.tokens.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 0)
+		deliveries, err := b.webhooks.Deliveries(hook, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(deliveries), 0)
+		_, err = b.webhooks.Get(hook, 1)
+		assertErrorIs(t, err, ErrNoRecord)
+		// The reports which user 2 filed and the reports of their snippets
+		// have gone with them.
+		reports, metadata, err := b.reports.Open(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reports), 0)
+		assert.Equal(t, metadata.TotalRecords, 0)
+	})
+}
+
+func TestConformanceSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.sessions
+		expires := time.Now().Add(time.Hour)
+		expired, err := m.Insert(1, "token-0", "Opera", "192.0.2.4", time.Now().Add(-time.Second))
+		assert.NilError(t, err)
+		ok, err := m.Touch(expired, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+		first, err := m.Insert(1, "token-1", "Firefox", "192.0.2.1", expires)
+		assert.NilError(t, err)
+		second, err := m.Insert(1, "token-2", "Safari", "192.0.2.2", expires)
+		assert.NilError(t, err)
+		carols, err := m.Insert(2, "token-3", "Chrome", "192.0.2.3", expires)
+		assert.NilError(t, err)
+		// The next login deleted the expired session.
+		assertErrorIs(t, m.Delete(expired, 1), ErrNoRecord)
+
+		ok, err = m.Touch(first, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, true)
+		ok, err = m.Touch(first, 2)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+
+		sessions, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(sessions), 2)
+		for _, s := range sessions {
+			assert.Equal(t, s.UserID, 1)
+			if s.ID == first {
+				assert.Equal(t, s.UserAgent, "Firefox")
+				assert.Equal(t, s.IP, "192.0.2.1")
+				assert.Equal(t, s.Expires.Equal(expires.Truncate(time.Second)), true)
+			}
+		}
+		all, err := m.All()
+		assert.NilError(t, err)
+		assert.Equal(t, len(all), 3)
+		tokens, err := m.Tokens(1)
+		assert.NilError(t, err)
+		sort.Strings(tokens)
+		assert.Equal(t, strings.Join(tokens, ","), "token-1,token-2")
+
+		assertErrorIs(t, m.Delete(carols, 1), ErrNoRecord)
+		assert.NilError(t, m.Delete(carols, 2))
+		assert.NilError(t, m.DeleteOthers(1, second))
+		ok, err = m.Touch(first, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, false)
+		ok, err = m.Touch(second, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, true)
+		assert.NilError(t, m.DeleteOthers(1, ""))
+		all, err = m.All()
+		assert.NilError(t, err)
+		assert.Equal(t, len(all), 0)
+	})
+}
+
+func TestConformanceReports(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		id, err := b.snippets.Insert(1, "Spam", "Buy now", 7)
+		assert.NilError(t, err)
+		n, err := b.reports.Insert(id, "user:2", ReasonSpam, "")
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		// Anonymous reports don't count towards hiding the snippet.
+		n, err = b.reports.Insert(id, "ip:192.0.2.1", ReasonOther, "Adverts")
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		_, err = b.reports.Insert(id, "user:2", ReasonMalware, "")
+		assertErrorIs(t, err, ErrDuplicateReport)
+
+		reports, metadata, err := b.reports.Open(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, metadata.TotalRecords, 2)
+		assert.Equal(t, len(reports), 2)
+		assert.Equal(t, reports[0].Reporter, "user:2")
+		assert.Equal(t, reports[1].Details, "Adverts")
+		assert.Equal(t, reports[1].SnippetTitle, "Spam")
+		assert.Equal(t, reports[1].SnippetUserID, 1)
+
+		assert.NilError(t, b.reports.Resolve(id, 3, DecisionHide))
+		assertErrorIs(t, b.reports.Resolve(id, 3, DecisionHide), ErrNoRecord)
+		reports, _, err = b.reports.Open(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reports), 0)
+
+		// Once the reports are resolved, the snippet can be reported again.
+		n, err = b.reports.Insert(id, "user:2", ReasonSpam, "Still spam")
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		_, err = b.reports.Insert(id, "user:2", ReasonSpam, "")
+		assertErrorIs(t, err, ErrDuplicateReport)
+
+		// Reports of snippets which have been deleted for good aren't
+		// listed or counted.
+		assert.NilError(t, b.snippets.Delete(id))
+		reports, metadata, err = b.reports.Open(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, len(reports), 0)
+		assert.Equal(t, metadata.TotalRecords, 0)
+	})
+}
+
+func TestConformanceAuditLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		for _, event := range []string{"login", "login_failed", "password_change"} {
+			e := &AuditEntry{ActorID: 1, Event: event, IP: "192.0.2.1", UserAgent: "Firefox"}
+			assert.NilError(t, b.auditLog.Insert(e))
+			if e.ID == 0 || e.Hash == "" {
+				t.Errorf("got ID %d and hash %q; want them filled in", e.ID, e.Hash)
+			}
+		}
+		brokenID, err := b.auditLog.Verify()
+		assert.NilError(t, err)
+		assert.Equal(t, brokenID, 0)
+
+		entries, metadata, err := b.auditLog.List(Filter{Query: "login", Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, metadata.TotalRecords, 2)
+		assert.Equal(t, entries[0].Event, "login_failed")
+		assert.Equal(t, entries[0].ActorID, 1)
+		assert.Equal(t, entries[0].Hash, entries[0].ComputeHash())
+	})
+}
+
+func TestConformanceTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.tokens
+		token, err := m.Insert(1, "laptop", ScopeWrite, time.Time{})
+		assert.NilError(t, err)
+		expired, err := m.Insert(1, "old", ScopeRead, time.Now().Add(-time.Hour))
+		assert.NilError(t, err)
+
+		got, err := m.Authenticate(token)
+		assert.NilError(t, err)
+		assert.Equal(t, got.UserID, 1)
+		assert.Equal(t, got.Scope, ScopeWrite)
+		assert.Equal(t, got.LastUsed.IsZero(), false)
+		_, err = m.Authenticate(expired)
+		assertErrorIs(t, err, ErrNoRecord)
+		_, err = m.Authenticate(TokenPrefix + "unknown")
+		assertErrorIs(t, err, ErrNoRecord)
+
+		tokens, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 2)
+		assert.Equal(t, tokens[0].Name, "old")
+		assertErrorIs(t, m.Delete(got.ID, 2), ErrNoRecord)
+		assert.NilError(t, m.Delete(got.ID, 1))
+		_, err = m.Authenticate(token)
+		assertErrorIs(t, err, ErrNoRecord)
+
+		_, err = m.Insert(2, "carol", ScopeRead, time.Time{})
+		assert.NilError(t, err)
+		n, err := m.DeleteAll(1)
+		assert.NilError(t, err)
+		assert.Equal(t, n, 1)
+		tokens, err = m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 0)
+		tokens, err = m.ForUser(2)
+		assert.NilError(t, err)
+		assert.Equal(t, len(tokens), 1)
+	})
+}
+
+func TestConformanceWebhooks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.webhooks
+		id, err := m.Insert(1, "https://example.com/hook")
+		assert.NilError(t, err)
+		h, err := m.Get(id, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, h.URL, "https://example.com/hook")
+		assert.Equal(t, len(h.Secret), 64)
+		_, err = m.Get(id, 2)
+		assertErrorIs(t, err, ErrNoRecord)
+		hooks, err := m.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, len(hooks), 1)
+
+		assert.NilError(t, m.Enqueue(1, EventSnippetCreated, []byte(`{"id":1}`)))
+		assert.NilError(t, m.Enqueue(2, EventSnippetCreated, []byte(`{"id":2}`)))
+		claimed, err := m.Claim(10, time.Minute)
+		assert.NilError(t, err)
+		assert.Equal(t, len(claimed), 1)
+		d := claimed[0]
+		assert.Equal(t, d.WebhookID, id)
+		assert.Equal(t, d.Event, EventSnippetCreated)
+		assert.Equal(t, string(d.Payload), `{"id":1}`)
+		assert.Equal(t, d.URL, h.URL)
+		assert.Equal(t, d.Secret, h.Secret)
+		// The delivery is leased, so it can't be claimed twice.
+		claimed, err = m.Claim(10, time.Minute)
+		assert.NilError(t, err)
+		assert.Equal(t, len(claimed), 0)
+
+		d.Record(200, nil, now())
+		assert.NilError(t, m.Save(d))
+		deliveries, err := m.Deliveries(id, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(deliveries), 1)
+		assert.Equal(t, deliveries[0].Status, DeliveryDelivered)
+		assert.Equal(t, deliveries[0].Attempts, 1)
+		assert.Equal(t, deliveries[0].ResponseCode, 200)
+
+		assertErrorIs(t, m.Delete(id, 2), ErrNoRecord)
+		assert.NilError(t, m.Delete(id, 1))
+		deliveries, err = m.Deliveries(id, 10)
+		assert.NilError(t, err)
+		assert.Equal(t, len(deliveries), 0)
+	})
+}
+
+func TestConformanceWebhookOrder(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		m := b.webhooks
+		_, err := m.Insert(1, "https://example.com/hook")
+		assert.NilError(t, err)
+		for i := 1; i <= 5; i++ {
+			assert.NilError(t, m.Enqueue(1, EventSnippetCreated, []byte(fmt.Sprintf(`{"id":%d}`, i))))
+		}
+		// Every claimed delivery gets the same lease, but they still come
+		// back in the order in which they were queued.
+		claimed, err := m.Claim(10, time.Minute)
+		assert.NilError(t, err)
+		assert.Equal(t, len(claimed), 5)
+		for i, d := range claimed {
+			assert.Equal(t, string(d.Payload), fmt.Sprintf(`{"id":%d}`, i+1))
+		}
+	})
+}
+
+func TestConformanceLoginLimiter(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		l := b.limiter(LoginLimiterPolicy{MaxAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour})
+		for i, want := range []time.Duration{0, time.Minute, 2 * time.Minute} {
+			lockout, err := l.Fail("account:alice2@example.com")
+			assert.NilError(t, err)
+			if lockout != want {
+				t.Errorf("failure %d: got lockout %v; want %v", i+1, lockout, want)
+			}
+		}
+		lockout, err := l.Check("account:alice2@example.com")
+		assert.NilError(t, err)
+		if lockout <= time.Minute || lockout > 2*time.Minute {
+			t.Errorf("got lockout %v; want just under 2m", lockout)
+		}
+		lockout, err = l.Check("account:carol@example.com")
+		assert.NilError(t, err)
+		assert.Equal(t, lockout, time.Duration(0))
+
+		assert.NilError(t, l.Reset("account:alice2@example.com"))
+		lockout, err = l.Check("account:alice2@example.com")
+		assert.NilError(t, err)
+		assert.Equal(t, lockout, time.Duration(0))
+	})
+}
+
+// Failures which happen at the same time, possibly on different instances,
+// are each counted once.
+func TestConformanceLoginLimiterConcurrent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		policy := LoginLimiterPolicy{MaxAttempts: 1, BaseLockout: time.Second, MaxLockout: time.Hour, Window: time.Hour}
+		l := b.limiter(policy)
+		const n = 10
+		lockouts := make([]time.Duration, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				lockouts[i], err = l.Fail("ip:192.0.2.1")
+				if err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		sort.Slice(lockouts, func(i, j int) bool { return lockouts[i] < lockouts[j] })
+		for i, lockout := range lockouts {
+			if want := policy.Lockout(i + 1); lockout != want {
+				t.Errorf("failure %d: got lockout %v; want %v", i+1, lockout, want)
+			}
+		}
+	})
+}
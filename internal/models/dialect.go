@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The SQL models work with MySQL, Postgres and SQLite. They stick to the SQL
+// which all three understand, and pass the current time in from Go rather than asking the
+// database for it. The few statements which can't be shared check the dialect
+// of the connection pool they were given.
+type dialect int
+
+const (
+	dialectMySQL dialect = iota
+	dialectSQLite
+	dialectPostgres
+)
+
+func dialectOf(db *sql.DB) dialect {
+	switch db.Driver().(type) {
+	case *sqlite.Driver:
+		return dialectSQLite
+	case postgresDriver:
+		return dialectPostgres
+	}
+	return dialectMySQL
+}
+
+// now returns the current time the way it is stored: in UTC, and in whole
+// seconds like a DATETIME column, so that a value read back compares equal to
+// the one which was written.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// truncate returns s cut down to at most n bytes for a VARCHAR(n) column. The
+// databases refuse to store invalid UTF-8, so s is cut at the start of a
+// character, and any invalid bytes it came with are replaced.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, string(utf8.RuneError))
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// isUniqueViolation reports whether err is a violation of a unique key. MySQL
+// and Postgres name the key, and SQLite the columns, so callers pass both: for
+// example "users_uc_email" and "users.email".
+func isUniqueViolation(err error, key, columns string) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, key)
+	}
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		return pgError.Code == "23505" && pgError.ConstraintName == key
+	}
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		return sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(sqliteError.Error(), columns)
+	}
+	return false
+}
+
+// ilike prepares the "LIKE ?"s in stmt for patterns from Filter.likePattern:
+// it gives them its escape character, and makes them ignore case on Postgres,
+// as they already do on MySQL (with the collation in the README) and SQLite.
+func ilike(db *sql.DB, stmt string) string {
+	like := " LIKE ? ESCAPE '!'"
+	if dialectOf(db) == dialectPostgres {
+		like = " ILIKE ? ESCAPE '!'"
+	}
+	return strings.ReplaceAll(stmt, " LIKE ?", like)
+}
+
+// execQueryer is what insertID needs of a *sql.DB or *sql.Conn.
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertID runs an INSERT statement and returns the ID of the new row. The
+// Postgres driver can't tell LastInsertId, so there the statement asks for it
+// with RETURNING instead.
+func insertID(ctx context.Context, d dialect, q execQueryer, stmt string, args ...any) (int, error) {
+	if d == dialectPostgres {
+		var id int
+		err := q.QueryRowContext(ctx, stmt+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := q.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// SQLiteDSN returns the data source name for opening the SQLite database file
+// at path with the settings which the models rely on: times are written in a
+// format which sorts in time order, transactions take the write lock as soon
+// as they begin (like MySQL's row locks, this stops two of them from reading
+// the same rows and then both writing), and a busy database is waited for
+// rather than reported as an error.
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_time_format=sqlite&_txlock=immediate&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"
+}
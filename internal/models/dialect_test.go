@@ -0,0 +1,49 @@
+package models
+
+import (
+	"GoWebPractice/internal/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{name: "Short", s: "Firefox", n: 10, want: "Firefox"},
+		{name: "ASCII", s: "Firefox", n: 4, want: "Fire"},
+		{name: "Character boundary", s: "añb", n: 3, want: "añ"},
+		{name: "Inside a character", s: "añb", n: 2, want: "a"},
+		{name: "Four bytes", s: "a😀", n: 4, want: "a"},
+		{name: "Invalid", s: "a\xffb", n: 10, want: "a�b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, truncate(tt.s, tt.n), tt.want)
+		})
+	}
+}
+
+// A user agent which is too long is cut down without splitting a character,
+// so that strict databases still accept it.
+func TestConformanceLongUserAgent(t *testing.T) {
+	userAgent := "Mozilla/5.0 " + strings.Repeat("ü", 200)
+	forEachBackend(t, func(t *testing.T, b backend) {
+		e := &AuditEntry{ActorID: 1, Event: "login", IP: "192.0.2.1", UserAgent: userAgent}
+		assert.NilError(t, b.auditLog.Insert(e))
+		entries, _, err := b.auditLog.List(Filter{Page: 1, PageSize: 10})
+		assert.NilError(t, err)
+		assert.Equal(t, entries[0].UserAgent, userAgent[:254])
+		assert.Equal(t, entries[0].Hash, entries[0].ComputeHash())
+
+		_, err = b.sessions.Insert(1, "token-1", userAgent, "192.0.2.1", now().Add(time.Hour))
+		assert.NilError(t, err)
+		sessions, err := b.sessions.ForUser(1)
+		assert.NilError(t, err)
+		assert.Equal(t, sessions[0].UserAgent, userAgent[:254])
+	})
+}
@@ -12,4 +12,10 @@ var (
 	// Add a new ErrDuplicateEmail error. We'll use this later if a user
 	// tries to signup with an email address that's already in use.
 	ErrDuplicateEmail = errors.New("models: duplicate email")
+	// ErrInactiveAccount is returned when the credentials are correct but the
+	// account has been deactivated.
+	ErrInactiveAccount = errors.New("models: inactive account")
+	// ErrDuplicateReport is returned when somebody reports the same snippet
+	// twice.
+	ErrDuplicateReport = errors.New("models: duplicate report")
 )
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Filter holds the search and pagination options for the List methods.
+type Filter struct {
+	Query    string
+	Page     int
+	PageSize int
+}
+
+func (f Filter) limit() int {
+	return f.PageSize
+}
+
+func (f Filter) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// likeEscaper escapes the wildcards of LIKE, and the escape character itself,
+// with "!". A backslash would need escaping differently in MySQL and Postgres
+// string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likePattern returns the search query as a LIKE pattern matching it literally
+// anywhere in the column. The statement must go through ilike, which adds the
+// ESCAPE clause.
+func (f Filter) likePattern() string {
+	return "%" + likeEscaper.Replace(f.Query) + "%"
+}
+
+// Metadata describes which page of a List result we are on.
+type Metadata struct {
+	CurrentPage  int
+	PageSize     int
+	LastPage     int
+	TotalRecords int
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{CurrentPage: 1, PageSize: pageSize, LastPage: 1}
+	}
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// PrevPage and NextPage return the neighbouring page numbers, or zero if there
+// is no such page. They are meant to be used from templates.
+func (m Metadata) PrevPage() int {
+	if m.CurrentPage <= 1 {
+		return 0
+	}
+	return m.CurrentPage - 1
+}
+
+func (m Metadata) NextPage() int {
+	if m.CurrentPage >= m.LastPage {
+		return 0
+	}
+	return m.CurrentPage + 1
+}
+
+// DailyCount is the number of records created on one day.
+type DailyCount struct {
+	Day   time.Time
+	Count int
+}
+
+// fillDays turns the sparse per-day counts returned by a GROUP BY query into
+// one entry for each of the last n days (ending today), with zero for days
+// that had no records.
+func fillDays(counts map[string]int, n int, now time.Time) []DailyCount {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := make([]DailyCount, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i)
+		days = append(days, DailyCount{Day: day, Count: counts[day.Format(time.DateOnly)]})
+	}
+	return days
+}
+
+// countPerDay counts the rows of table created on each of the last n days.
+// The table name is never user input.
+func countPerDay(db *sql.DB, table string, n int) ([]DailyCount, error) {
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -n)
+	stmt := "SELECT DATE(created), COUNT(*) FROM " + table + " WHERE created >= ? GROUP BY DATE(created)"
+	rows, err := db.Query(stmt, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day dayValue
+		var count int
+		err = rows.Scan(&day, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[string(day)] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return fillDays(counts, n, now), nil
+}
+
+// dayValue scans the result of DATE(), which MySQL returns as a time and
+// SQLite as text, into the form used as a key by fillDays.
+type dayValue string
+
+func (d *dayValue) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = dayValue(v.Format(time.DateOnly))
+	case string:
+		*d = dayValue(v)
+	case []byte:
+		*d = dayValue(v)
+	default:
+		return fmt.Errorf("models: can't scan %T as a day", src)
+	}
+	return nil
+}
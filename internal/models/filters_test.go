@@ -0,0 +1,42 @@
+package models
+
+import (
+	"GoWebPractice/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestCalculateMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		page     int
+		wantLast int
+		wantPrev int
+		wantNext int
+	}{
+		{name: "Empty", total: 0, page: 1, wantLast: 1, wantPrev: 0, wantNext: 0},
+		{name: "First page", total: 45, page: 1, wantLast: 3, wantPrev: 0, wantNext: 2},
+		{name: "Middle page", total: 45, page: 2, wantLast: 3, wantPrev: 1, wantNext: 3},
+		{name: "Last page", total: 40, page: 2, wantLast: 2, wantPrev: 1, wantNext: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := calculateMetadata(tt.total, tt.page, 20)
+			assert.Equal(t, m.LastPage, tt.wantLast)
+			assert.Equal(t, m.PrevPage(), tt.wantPrev)
+			assert.Equal(t, m.NextPage(), tt.wantNext)
+		})
+	}
+}
+
+func TestFillDays(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	days := fillDays(map[string]int{"2024-03-15": 2, "2024-03-17": 5}, 3, now)
+	assert.Equal(t, len(days), 3)
+	assert.Equal(t, days[0].Day.Format(time.DateOnly), "2024-03-15")
+	assert.Equal(t, days[0].Count, 2)
+	assert.Equal(t, days[1].Count, 0)
+	assert.Equal(t, days[2].Day.Format(time.DateOnly), "2024-03-17")
+	assert.Equal(t, days[2].Count, 5)
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LoginLimiterInterface tracks failed login attempts for an arbitrary key
+// (for example an email address or a client IP) and decides how long that key
+// is locked out for. Both the in-memory and the MySQL implementations below
+// satisfy it, so the handlers don't need to care where the state lives.
+type LoginLimiterInterface interface {
+	// Check returns how much longer the key is locked out for, or zero if a
+	// login attempt is currently allowed.
+	Check(key string) (time.Duration, error)
+	// Fail records a failed attempt and returns the resulting lockout.
+	Fail(key string) (time.Duration, error)
+	// Reset forgets all failed attempts for the key.
+	Reset(key string) error
+}
+
+// LoginLimiterPolicy describes when a key gets locked out and for how long.
+// The first MaxAttempts failures are free; every failure after that doubles the
+// lockout, starting at BaseLockout and never exceeding MaxLockout. Failures
+// older than Window are forgotten.
+type LoginLimiterPolicy struct {
+	MaxAttempts int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	Window      time.Duration
+}
+
+// DefaultAccountPolicy is used for per-account limits, and DefaultIPPolicy for
+// per-IP limits. A single IP is allowed more failures because several people
+// can share one address.
+var (
+	DefaultAccountPolicy = LoginLimiterPolicy{MaxAttempts: 5, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	DefaultIPPolicy      = LoginLimiterPolicy{MaxAttempts: 20, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+)
+
+// Lockout returns the lockout duration after the given number of consecutive
+// failures.
+func (p LoginLimiterPolicy) Lockout(failures int) time.Duration {
+	if failures < p.MaxAttempts {
+		return 0
+	}
+	d := p.BaseLockout
+	for i := p.MaxAttempts; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return min(d, p.MaxLockout)
+}
+
+type loginAttempt struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// expired reports whether the attempt can be forgotten: its failures are
+// outside of the window and it is no longer locked out.
+func (a *loginAttempt) expired(now time.Time, window time.Duration) bool {
+	return now.Sub(a.lastFailure) > window && !a.lockedUntil.After(now)
+}
+
+// loginSweepInterval is how often Fail looks for expired attempts to forget,
+// so that the counters for keys which are never seen again don't pile up.
+const loginSweepInterval = time.Minute
+
+// MemoryLoginLimiter keeps the attempt counters in process memory. It is fine
+// for a single instance of the application (and for tests), but the counters
+// are lost on restart and are not shared between instances.
+type MemoryLoginLimiter struct {
+	Policy LoginLimiterPolicy
+	// Now can be overridden in tests. It defaults to time.Now.
+	Now func() time.Time
+
+	mu        sync.Mutex
+	attempts  map[string]*loginAttempt
+	lastSweep time.Time
+}
+
+func NewMemoryLoginLimiter(policy LoginLimiterPolicy) *MemoryLoginLimiter {
+	return &MemoryLoginLimiter{
+		Policy:   policy,
+		Now:      time.Now,
+		attempts: make(map[string]*loginAttempt),
+	}
+}
+
+func (m *MemoryLoginLimiter) Check(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(a.lockedUntil.Sub(m.Now()), 0), nil
+}
+
+func (m *MemoryLoginLimiter) Fail(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.Now()
+	if now.Sub(m.lastSweep) >= loginSweepInterval {
+		for k, a := range m.attempts {
+			if a.expired(now, m.Policy.Window) {
+				delete(m.attempts, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	a, ok := m.attempts[key]
+	if !ok || now.Sub(a.lastFailure) > m.Policy.Window {
+		a = &loginAttempt{}
+		m.attempts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	lockout := m.Policy.Lockout(a.failures)
+	a.lockedUntil = now.Add(lockout)
+	return lockout, nil
+}
+
+func (m *MemoryLoginLimiter) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// LoginAttemptModel stores the attempt counters in the login_attempts table,
+// so that every instance of the application behind a load balancer sees the
+// same state.
+type LoginAttemptModel struct {
+	DB     *sql.DB
+	Policy LoginLimiterPolicy
+}
+
+func (m *LoginAttemptModel) Check(key string) (time.Duration, error) {
+	var lockedUntil time.Time
+	stmt := "SELECT locked_until FROM login_attempts WHERE attempt_key = ?"
+	err := m.DB.QueryRow(stmt, key).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return max(time.Until(lockedUntil), 0), nil
+}
+
+// Fail runs in a transaction. The upsert locks the key's row, so a concurrent
+// Fail for the same key, on this instance or another, waits until the lockout
+// for this failure has been written, and then counts on from it.
+func (m *LoginAttemptModel) Fail(key string) (time.Duration, error) {
+	now := time.Now().UTC()
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	// Increment the counter, starting again from 1 if the previous failure
+	// has fallen outside of the policy window. The databases only disagree on
+	// how to say "or update it if it's already there". Postgres needs the
+	// existing row's columns to be qualified with the table name.
+	stmt := `INSERT INTO login_attempts (attempt_key, failures, last_failure, locked_until)
+	VALUES (?, 1, ?, ?)`
+	if dialectOf(m.DB) != dialectMySQL {
+		stmt += `
+	ON CONFLICT (attempt_key) DO UPDATE SET
+	failures = CASE WHEN login_attempts.last_failure < ? THEN 1 ELSE login_attempts.failures + 1 END,
+	last_failure = excluded.last_failure`
+	} else {
+		stmt += `
+	ON DUPLICATE KEY UPDATE
+	failures = IF(last_failure < ?, 1, failures + 1), last_failure = VALUES(last_failure)`
+	}
+	_, err = tx.Exec(stmt, key, now, now, now.Add(-m.Policy.Window))
+	if err != nil {
+		return 0, err
+	}
+	var failures int
+	err = tx.QueryRow("SELECT failures FROM login_attempts WHERE attempt_key = ?", key).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	lockout := m.Policy.Lockout(failures)
+	_, err = tx.Exec("UPDATE login_attempts SET locked_until = ? WHERE attempt_key = ?", now.Add(lockout), key)
+	if err != nil {
+		return 0, err
+	}
+	return lockout, tx.Commit()
+}
+
+func (m *LoginAttemptModel) Reset(key string) error {
+	_, err := m.DB.Exec("DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
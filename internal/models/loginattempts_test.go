@@ -0,0 +1,105 @@
+package models
+
+import (
+	"GoWebPractice/internal/assert"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterPolicyLockout(t *testing.T) {
+	policy := LoginLimiterPolicy{MaxAttempts: 3, BaseLockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{name: "Below limit", failures: 2, want: 0},
+		{name: "At limit", failures: 3, want: time.Minute},
+		{name: "Doubles", failures: 4, want: 2 * time.Minute},
+		{name: "Doubles again", failures: 5, want: 4 * time.Minute},
+		{name: "Capped", failures: 9, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, policy.Lockout(tt.failures), tt.want)
+		})
+	}
+}
+
+func TestMemoryLoginLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemoryLoginLimiter(LoginLimiterPolicy{
+		MaxAttempts: 2, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour,
+	})
+	m.Now = func() time.Time { return now }
+
+	lockout, err := m.Fail("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Duration(0))
+
+	lockout, err = m.Fail("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Minute)
+
+	// Other keys are unaffected.
+	lockout, err = m.Check("account:bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Duration(0))
+
+	now = now.Add(30 * time.Second)
+	lockout, err = m.Check("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, 30*time.Second)
+
+	now = now.Add(time.Minute)
+	lockout, err = m.Check("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Duration(0))
+
+	// Failures outside of the window are forgotten.
+	now = now.Add(2 * time.Hour)
+	lockout, err = m.Fail("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Duration(0))
+
+	assert.NilError(t, m.Reset("account:alice@example.com"))
+	lockout, err = m.Check("account:alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, time.Duration(0))
+}
+
+func TestMemoryLoginLimiterSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemoryLoginLimiter(LoginLimiterPolicy{
+		MaxAttempts: 2, BaseLockout: 2 * time.Hour, MaxLockout: 2 * time.Hour, Window: time.Hour,
+	})
+	m.Now = func() time.Time { return now }
+
+	// One key is locked out for longer than the window, and the others have
+	// only failed once.
+	for _, key := range []string{"account:a@example.com", "account:b@example.com", "ip:192.0.2.1"} {
+		_, err := m.Fail(key)
+		assert.NilError(t, err)
+	}
+	_, err := m.Fail("account:locked@example.com")
+	assert.NilError(t, err)
+	_, err = m.Fail("account:locked@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, len(m.attempts), 4)
+
+	// Once the window has passed, the next failure forgets the keys which
+	// aren't locked out any more.
+	now = now.Add(90 * time.Minute)
+	_, err = m.Fail("ip:192.0.2.2")
+	assert.NilError(t, err)
+	assert.Equal(t, len(m.attempts), 2)
+	lockout, err := m.Check("account:locked@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, lockout, 30*time.Minute)
+
+	now = now.Add(time.Hour)
+	_, err = m.Fail("ip:192.0.2.3")
+	assert.NilError(t, err)
+	assert.Equal(t, len(m.attempts), 2)
+}
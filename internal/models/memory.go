@@ -0,0 +1,114 @@
+package models
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDB keeps everything which the SQL models keep in a database in
+// process memory instead. It is for trying the application out and for
+// tests: nothing survives a restart, and it can't be shared between
+// instances. The memory models, like MemorySnippetModel, take a MemoryDB as
+// their DB in the same way that the SQL models take a *sql.DB, and behave in
+// the same way.
+//
+// Rows are kept in slices in the order they were inserted, which is also the
+// order of their IDs, and every lookup is a scan. That is fine for the amount
+// of data a MemoryDB is meant for.
+type MemoryDB struct {
+	mu         sync.Mutex
+	lastID     map[string]int
+	snippets   []*Snippet
+	users      []*User
+	sessions   []*Session
+	reports    []*memoryReport
+	audit      []*AuditEntry
+	tokens     []*memoryToken
+	webhooks   []*Webhook
+	deliveries []*WebhookDelivery
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{lastID: make(map[string]int)}
+}
+
+// nextID returns the next ID for the table, like AUTO_INCREMENT. IDs are
+// never reused, even after the row with the last one has been deleted.
+func (db *MemoryDB) nextID(table string) int {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+// user returns the user with the given ID, or nil. The caller must hold the
+// lock, as for every other unexported method of MemoryDB.
+func (db *MemoryDB) user(id int) *User {
+	for _, u := range db.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// visible is visibleSnippet for a MemoryDB, together with the expiry check
+// which goes with it everywhere.
+func (db *MemoryDB) visible(s *Snippet, at time.Time) bool {
+	if s.Deleted || s.Hidden || !s.Expires.After(at) {
+		return false
+	}
+	if s.UserID == 0 {
+		return true
+	}
+	u := db.user(s.UserID)
+	return u != nil && u.Active
+}
+
+// deleteWhere removes the elements of s for which del returns true, and
+// returns the rest along with how many were removed.
+func deleteWhere[T any](s []T, del func(T) bool) ([]T, int) {
+	kept := s[:0]
+	for _, v := range s {
+		if !del(v) {
+			kept = append(kept, v)
+		}
+	}
+	n := len(s) - len(kept)
+	clear(s[len(kept):])
+	return kept, n
+}
+
+// paginate returns the page of items selected by the filter, with its
+// metadata, in the same way as LIMIT and OFFSET.
+func paginate[T any](items []T, f Filter) ([]T, Metadata) {
+	start := min(max(f.offset(), 0), len(items))
+	end := min(start+f.limit(), len(items))
+	page := make([]T, 0, end-start)
+	page = append(page, items[start:end]...)
+	return page, calculateMetadata(len(items), f.Page, f.PageSize)
+}
+
+// matches is the LIKE of the filter's query, which (with the collations the
+// databases use) ignores case.
+func (f Filter) matches(values ...string) bool {
+	query := strings.ToLower(f.Query)
+	for _, v := range values {
+		if strings.Contains(strings.ToLower(v), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// countCreatedPerDay is countPerDay for a MemoryDB.
+func countCreatedPerDay(created []time.Time, n int) []DailyCount {
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -n)
+	counts := map[string]int{}
+	for _, t := range created {
+		if !t.Before(since) {
+			counts[t.Format(time.DateOnly)]++
+		}
+	}
+	return fillDays(counts, n, now)
+}
@@ -0,0 +1,65 @@
+package mocks
+
+import (
+	"GoWebPractice/internal/models"
+	"sync"
+	"time"
+)
+
+// AuditModel keeps the log in memory, so that tests can check which events
+// were recorded.
+type AuditModel struct {
+	mu      sync.Mutex
+	Entries []*models.AuditEntry
+}
+
+func (m *AuditModel) Insert(e *models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = len(m.Entries) + 1
+	e.Created = time.Now().UTC().Truncate(time.Second)
+	if len(m.Entries) > 0 {
+		e.PrevHash = m.Entries[len(m.Entries)-1].Hash
+	}
+	e.Hash = e.ComputeHash()
+	m.Entries = append(m.Entries, e)
+	return nil
+}
+
+// Events returns the names of the recorded events, oldest first.
+func (m *AuditModel) Events() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make([]string, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		events = append(events, e.Event)
+	}
+	return events
+}
+
+func (m *AuditModel) List(f models.Filter) ([]*models.AuditEntry, models.Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := []*models.AuditEntry{}
+	for i := len(m.Entries) - 1; i >= 0; i-- {
+		entries = append(entries, m.Entries[i])
+	}
+	return entries, models.Metadata{CurrentPage: 1, PageSize: f.PageSize, LastPage: 1, TotalRecords: len(entries)}, nil
+}
+
+func (m *AuditModel) Each(fn func(*models.AuditEntry) error) error {
+	m.mu.Lock()
+	entries := append([]*models.AuditEntry(nil), m.Entries...)
+	m.mu.Unlock()
+	for _, e := range entries {
+		err := fn(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *AuditModel) Verify() (int, error) {
+	return models.VerifyAuditChain(m.Each)
+}
@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"GoWebPractice/internal/models"
+	"time"
+)
+
+// The mock snippet already has two open reports, so the next one pushes it
+// over the default auto-hide threshold of three.
+var mockReport = &models.Report{
+	ID:             1,
+	SnippetID:      1,
+	SnippetTitle:   mockSnippet.Title,
+	SnippetContent: mockSnippet.Content,
+	SnippetUserID:  mockSnippet.UserID,
+	Reporter:       "user:3",
+	Reason:         models.ReasonSpam,
+	Details:        "Buy cheap haikus",
+	Created:        time.Now(),
+}
+
+type ReportModel struct{}
+
+func (m *ReportModel) Insert(snippetID int, reporter string, reason models.ReportReason, details string) (int, error) {
+	if reporter == mockReport.Reporter {
+		return 0, models.ErrDuplicateReport
+	}
+	return 3, nil
+}
+
+func (m *ReportModel) Open(f models.Filter) ([]*models.Report, models.Metadata, error) {
+	return []*models.Report{mockReport}, models.Metadata{CurrentPage: 1, PageSize: f.PageSize, LastPage: 1, TotalRecords: 1}, nil
+}
+
+func (m *ReportModel) Resolve(snippetID, moderatorID int, decision models.Decision) error {
+	if snippetID == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
@@ -0,0 +1,66 @@
+package mocks
+
+import (
+	"GoWebPractice/internal/models"
+	"sync"
+	"time"
+)
+
+// Every login gets the same session ID. A second session for Alice exists so
+// that there is something to revoke.
+const (
+	MockSessionID  = "session-1"
+	OtherSessionID = "session-2"
+)
+
+// SessionModel remembers the scs token of every login, so that Tokens can
+// return them, but nothing else sees them.
+type SessionModel struct {
+	mu     sync.Mutex
+	tokens map[int][]string
+}
+
+func (m *SessionModel) Insert(userID int, token, userAgent, ip string, expires time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = map[int][]string{}
+	}
+	m.tokens[userID] = append(m.tokens[userID], token)
+	return MockSessionID, nil
+}
+
+func (m *SessionModel) Tokens(userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.tokens[userID]...), nil
+}
+
+func (m *SessionModel) Touch(id string, userID int) (bool, error) {
+	return id == MockSessionID, nil
+}
+
+func (m *SessionModel) ForUser(userID int) ([]*models.Session, error) {
+	if userID != 1 {
+		return []*models.Session{}, nil
+	}
+	return []*models.Session{
+		{ID: MockSessionID, UserID: 1, UserAgent: "Go-http-client/1.1", IP: "127.0.0.1", Created: time.Now(), LastSeen: time.Now(), Expires: time.Now().Add(time.Hour)},
+		{ID: OtherSessionID, UserID: 1, UserAgent: "Mozilla/5.0", IP: "192.0.2.1", Created: time.Now(), LastSeen: time.Now(), Expires: time.Now().Add(time.Hour)},
+	}, nil
+}
+
+func (m *SessionModel) All() ([]*models.Session, error) {
+	return m.ForUser(1)
+}
+
+func (m *SessionModel) Delete(id string, userID int) error {
+	if userID == 1 && (id == MockSessionID || id == OtherSessionID) {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SessionModel) DeleteOthers(userID int, keepID string) error {
+	return nil
+}
@@ -2,10 +2,12 @@ package mocks
 
 import (
 	"GoWebPractice/internal/models"
+	"strings"
 	"time"
 )
 
 var mockSnippet = &models.Snippet{ID: 1,
+	UserID:  1,
 	Title:   "An old silent pond",
 	Content: "An old silent pond...",
 	Created: time.Now(),
@@ -14,8 +16,10 @@ var mockSnippet = &models.Snippet{ID: 1,
 
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	return 2, nil
+// Insert pretends to create the mock snippet, so that handlers can read back
+// what they created with Get.
+func (m *SnippetModel) Insert(userID int, title string, content string, expires int) (int, error) {
+	return mockSnippet.ID, nil
 }
 func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 	switch id {
@@ -25,6 +29,94 @@ func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
 		return nil, models.ErrNoRecord
 	}
 }
+func (m *SnippetModel) Update(id int, title string, content string, expires int) error {
+	if id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	if id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	return 0, nil
+}
+
 func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) LatestForUser(userID int) ([]*models.Snippet, error) {
+	if userID == 1 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) ForUser(userID int) ([]*models.Snippet, error) {
+	if userID == 1 {
+		return []*models.Snippet{mockSnippet}, nil
+	}
+	return []*models.Snippet{}, nil
+}
+
+func (m *SnippetModel) List(f models.Filter) ([]*models.Snippet, models.Metadata, error) {
+	snippets := []*models.Snippet{}
+	if strings.Contains(mockSnippet.Title, f.Query) {
+		snippets = append(snippets, mockSnippet)
+	}
+	return snippets, models.Metadata{CurrentPage: 1, PageSize: f.PageSize, LastPage: 1, TotalRecords: len(snippets)}, nil
+}
+
+func (m *SnippetModel) Search(f models.Filter) ([]*models.Snippet, models.Metadata, error) {
+	snippets := []*models.Snippet{}
+	if strings.Contains(mockSnippet.Title, f.Query) || strings.Contains(mockSnippet.Content, f.Query) {
+		snippets = append(snippets, mockSnippet)
+	}
+	return snippets, models.Metadata{CurrentPage: 1, PageSize: f.PageSize, LastPage: 1, TotalRecords: len(snippets)}, nil
+}
+
+func (m *SnippetModel) SetDeleted(id int, deleted bool) error {
+	if id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SnippetModel) CreatedPerDay(days int) ([]models.DailyCount, error) {
+	return mockDailyCounts(days), nil
+}
+
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	if id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
+
+// Owner also knows snippets 3 and 4, which belong to the moderator and the
+// admin, for checking that staff can't be banned.
+func (m *SnippetModel) Owner(id int) (int, error) {
+	switch id {
+	case 1:
+		return mockSnippet.UserID, nil
+	case 3, 4:
+		return id, nil
+	}
+	return 0, models.ErrNoRecord
+}
+
+// mockDailyCounts returns one record per day for the last n days.
+func mockDailyCounts(n int) []models.DailyCount {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	counts := make([]models.DailyCount, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		counts = append(counts, models.DailyCount{Day: today.AddDate(0, 0, -i), Count: 1})
+	}
+	return counts
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"GoWebPractice/internal/models"
+	"time"
+)
+
+// Tokens accepted by the mock, both belonging to Alice.
+const (
+	MockReadToken  = "sbx_read"
+	MockWriteToken = "sbx_write"
+	// MockNewToken is returned for every token created through the mock.
+	MockNewToken = "sbx_new"
+)
+
+var mockTokens = []*models.APIToken{
+	{ID: 1, UserID: 1, Name: "Backup script", Scope: models.ScopeRead, Created: time.Now()},
+	{ID: 2, UserID: 1, Name: "Deploy", Scope: models.ScopeWrite, Created: time.Now(), Expires: time.Now().Add(24 * time.Hour)},
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(userID int, name string, scope models.TokenScope, expires time.Time) (string, error) {
+	return MockNewToken, nil
+}
+
+func (m *TokenModel) ForUser(userID int) ([]*models.APIToken, error) {
+	if userID != 1 {
+		return []*models.APIToken{}, nil
+	}
+	return mockTokens, nil
+}
+
+func (m *TokenModel) Delete(id, userID int) error {
+	for _, t := range mockTokens {
+		if t.ID == id && t.UserID == userID {
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *TokenModel) DeleteAll(userID int) (int, error) {
+	tokens, err := m.ForUser(userID)
+	return len(tokens), err
+}
+
+func (m *TokenModel) Authenticate(token string) (*models.APIToken, error) {
+	switch token {
+	case MockReadToken:
+		return mockTokens[0], nil
+	case MockWriteToken:
+		return mockTokens[1], nil
+	default:
+		return nil, models.ErrNoRecord
+	}
+}
@@ -2,53 +2,164 @@ package mocks
 
 import (
 	"GoWebPractice/internal/models"
+	"strings"
+	"sync"
 	"time"
 )
 
-type UserModel struct{}
+// The mock users all have the password "pa$$word". Carol's account has been
+// deactivated.
+var mockUsers = []*models.User{
+	{ID: 1, Name: "Alice", Email: "alice@example.com", Active: true, Role: models.RoleUser},
+	{ID: 2, Name: "Carol", Email: "carol@example.com", Active: false, Role: models.RoleUser},
+	{ID: 3, Name: "Mallory", Email: "mod@example.com", Active: true, Role: models.RoleModerator},
+	{ID: 4, Name: "Adam", Email: "admin@example.com", Active: true, Role: models.RoleAdmin},
+}
+
+func findUser(id int) *models.User {
+	for _, u := range mockUsers {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// UserModel remembers the users inserted into it, so that GetByEmail can
+// find them, but nothing else sees them.
+type UserModel struct {
+	mu       sync.Mutex
+	inserted []*models.User
+}
 
 func (m *UserModel) Insert(name, email, password string) error {
 	switch email {
 	case "dupe@example.com":
 		return models.ErrDuplicateEmail
 	default:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.inserted = append(m.inserted, &models.User{
+			ID:      100 + len(m.inserted),
+			Name:    name,
+			Email:   email,
+			Created: time.Now(),
+			Active:  true,
+			Role:    models.RoleUser,
+		})
 		return nil
 	}
 }
+func (m *UserModel) wasInserted(id int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.inserted {
+		if u.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+	for _, u := range mockUsers {
+		if u.Email == email && password == "pa$$word" {
+			if !u.Active {
+				return 0, models.ErrInactiveAccount
+			}
+			return u.ID, nil
+		}
 	}
 	return 0, models.ErrInvalidCredentials
 }
 func (m *UserModel) Exists(id int) (bool, error) {
-	switch id {
-	case 1:
-		return true, nil
-	default:
-		return false, nil
-	}
+	u := findUser(id)
+	return u != nil && u.Active, nil
 }
 
 func (m *UserModel) Get(id int) (*models.User, error) {
-	if id == 1 {
-		u := &models.User{
-			ID:      1,
-			Name:    "Alice",
-			Email:   "alice@example.com",
-			Created: time.Now(),
+	u := findUser(id)
+	if u == nil {
+		return nil, models.ErrNoRecord
+	}
+	// Return a copy, so that handlers can't change the shared mock data.
+	user := *u
+	user.Created = time.Now()
+	return &user, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	for _, u := range mockUsers {
+		if u.Email == email {
+			return m.Get(u.ID)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.inserted {
+		if u.Email == email {
+			user := *u
+			return &user, nil
 		}
-		return u, nil
 	}
 	return nil, models.ErrNoRecord
 }
 
 func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
-	if id == 1 {
-		if currentPassword != "pa$$word" {
-			return models.ErrInvalidCredentials
-		}
+	if findUser(id) == nil {
+		return models.ErrNoRecord
+	}
+	if currentPassword != "pa$$word" {
+		return models.ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (m *UserModel) SetPassword(id int, password string) error {
+	if findUser(id) == nil {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) CheckPassword(id int, password string) error {
+	if findUser(id) != nil && password == "pa$$word" {
 		return nil
 	}
-	return models.ErrNoRecord
+	return models.ErrInvalidCredentials
+}
+
+func (m *UserModel) SetActive(id int, active bool) error {
+	if findUser(id) == nil {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) SetRole(id int, role models.Role) error {
+	if findUser(id) == nil && !m.wasInserted(id) {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) Delete(id int, policy models.DeletionPolicy) error {
+	if findUser(id) == nil {
+		return models.ErrNoRecord
+	}
+	return nil
+}
+
+func (m *UserModel) List(f models.Filter) ([]*models.User, models.Metadata, error) {
+	users := []*models.User{}
+	for _, u := range mockUsers {
+		if strings.Contains(u.Name, f.Query) || strings.Contains(u.Email, f.Query) {
+			users = append(users, u)
+		}
+	}
+	return users, models.Metadata{CurrentPage: 1, PageSize: f.PageSize, LastPage: 1, TotalRecords: len(users)}, nil
+}
+
+func (m *UserModel) SignupsPerDay(days int) ([]models.DailyCount, error) {
+	return mockDailyCounts(days), nil
 }
@@ -0,0 +1,150 @@
+package mocks
+
+import (
+	"GoWebPractice/internal/models"
+	"sync"
+	"time"
+)
+
+// WebhookModel keeps webhooks and their deliveries in memory, so that tests
+// can run the delivery worker against real receivers. The zero value has no
+// webhooks.
+type WebhookModel struct {
+	mu         sync.Mutex
+	Webhooks   []*models.Webhook
+	Queue      []*models.WebhookDelivery
+	nextHookID int
+}
+
+func (m *WebhookModel) Insert(userID int, url string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextHookID++
+	m.Webhooks = append(m.Webhooks, &models.Webhook{
+		ID:      m.nextHookID,
+		UserID:  userID,
+		URL:     url,
+		Secret:  "mock-secret",
+		Created: time.Now(),
+	})
+	return m.nextHookID, nil
+}
+
+func (m *WebhookModel) Get(id, userID int) (*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range m.Webhooks {
+		if h.ID == id && h.UserID == userID {
+			return h, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *WebhookModel) ForUser(userID int) ([]*models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hooks := []*models.Webhook{}
+	for _, h := range m.Webhooks {
+		if h.UserID == userID {
+			hooks = append(hooks, h)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *WebhookModel) Delete(id, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, h := range m.Webhooks {
+		if h.ID == id && h.UserID == userID {
+			m.Webhooks = append(m.Webhooks[:i], m.Webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *WebhookModel) Enqueue(userID int, event models.WebhookEvent, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, h := range m.Webhooks {
+		if h.UserID == userID {
+			m.enqueue(h.ID, event, payload)
+		}
+	}
+	return nil
+}
+
+func (m *WebhookModel) EnqueueFor(webhookID int, event models.WebhookEvent, payload []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enqueue(webhookID, event, payload)
+	return nil
+}
+
+func (m *WebhookModel) enqueue(webhookID int, event models.WebhookEvent, payload []byte) {
+	now := time.Now().UTC()
+	m.Queue = append(m.Queue, &models.WebhookDelivery{
+		ID:          len(m.Queue) + 1,
+		WebhookID:   webhookID,
+		Event:       event,
+		Payload:     payload,
+		Status:      models.DeliveryPending,
+		NextAttempt: now,
+		Created:     now,
+	})
+}
+
+// Claim hands out copies of the due deliveries, like the database would.
+func (m *WebhookModel) Claim(limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	deliveries := []*models.WebhookDelivery{}
+	for _, d := range m.Queue {
+		if len(deliveries) == limit {
+			break
+		}
+		if d.Status != models.DeliveryPending || d.NextAttempt.After(now) {
+			continue
+		}
+		d.NextAttempt = now.Add(lease)
+		claimed := *d
+		for _, h := range m.Webhooks {
+			if h.ID == d.WebhookID {
+				claimed.URL, claimed.Secret = h.URL, h.Secret
+			}
+		}
+		deliveries = append(deliveries, &claimed)
+	}
+	return deliveries, nil
+}
+
+func (m *WebhookModel) Save(d *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *d
+	m.Queue[d.ID-1] = &saved
+	return nil
+}
+
+func (m *WebhookModel) Deliveries(webhookID, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []*models.WebhookDelivery{}
+	for i := len(m.Queue) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.Queue[i].WebhookID == webhookID {
+			deliveries = append(deliveries, m.Queue[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// Delivery returns a copy of a queued delivery, so that tests can inspect it
+// without racing the worker.
+func (m *WebhookModel) Delivery(id int) models.WebhookDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.Queue[id-1]
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// OpenPostgres opens a connection pool to the Postgres database described by
+// dsn, which is a URL or key=value connection string as understood by libpq.
+// The models write their placeholders as ?, like MySQL and SQLite, so the
+// connections rewrite them into Postgres's $1, $2, ... before sending a
+// statement. Sessions use UTC, so that DATE() of a TIMESTAMPTZ is the UTC day
+// as on the other databases.
+func OpenPostgres(dsn string) (*sql.DB, error) {
+	c, err := newPostgresConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(c), nil
+}
+
+func newPostgresConnector(dsn string) (postgresConnector, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return postgresConnector{}, err
+	}
+	config.RuntimeParams["timezone"] = "UTC"
+	return postgresConnector{stdlib.GetConnector(*config)}, nil
+}
+
+// postgresDriver is the driver.Driver of the connection pools returned by
+// OpenPostgres, which is what dialectOf looks for.
+type postgresDriver struct{}
+
+func (postgresDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := newPostgresConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pgConn, ok := conn.(*stdlib.Conn)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("models: unexpected Postgres connection type")
+	}
+	return postgresConn{pgConn}, nil
+}
+
+func (postgresConnector) Driver() driver.Driver {
+	return postgresDriver{}
+}
+
+// postgresConn is a pgx connection which rewrites placeholders. Everything
+// else, including transactions, is passed straight through.
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (c postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebind(query))
+}
+
+func (c postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.ExecContext(ctx, rebind(query), args)
+}
+
+func (c postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.QueryContext(ctx, rebind(query), args)
+}
+
+// rebind replaces the ? placeholders in query with $1, $2 and so on. Question
+// marks in quoted strings and identifiers are left alone.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
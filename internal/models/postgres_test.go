@@ -0,0 +1,25 @@
+package models
+
+import (
+	"GoWebPractice/internal/assert"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "No placeholders", query: "SELECT 1", want: "SELECT 1"},
+		{name: "Placeholders", query: "SELECT id FROM users WHERE email = ? AND active = ?", want: "SELECT id FROM users WHERE email = $1 AND active = $2"},
+		{name: "Quoted", query: "SELECT '?', \"a?\" FROM t WHERE id = ?", want: "SELECT '?', \"a?\" FROM t WHERE id = $1"},
+		{name: "Escaped quote", query: "SELECT 'it''s ?' WHERE a = ?", want: "SELECT 'it''s ?' WHERE a = $1"},
+		{name: "In list", query: "id IN (?, ?, ?)", want: "id IN ($1, $2, $3)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, rebind(tt.query), tt.want)
+		})
+	}
+}
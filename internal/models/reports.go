@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// ReportReason is why somebody reported a snippet.
+type ReportReason string
+
+const (
+	ReasonSpam    ReportReason = "spam"
+	ReasonMalware ReportReason = "malware"
+	ReasonSecrets ReportReason = "secrets"
+	ReasonOther   ReportReason = "other"
+)
+
+var ReportReasons = []ReportReason{ReasonSpam, ReasonMalware, ReasonSecrets, ReasonOther}
+
+// Decision is what a moderator decided to do about a reported snippet.
+type Decision string
+
+const (
+	// DecisionDismiss closes the reports and makes the snippet visible again
+	// if it was hidden automatically.
+	DecisionDismiss Decision = "dismiss"
+	// DecisionHide hides the snippet.
+	DecisionHide Decision = "hide"
+	// DecisionBan hides the snippet and deactivates its author.
+	DecisionBan Decision = "ban"
+)
+
+var Decisions = []Decision{DecisionDismiss, DecisionHide, DecisionBan}
+
+type ReportModelInterface interface {
+	Insert(snippetID int, reporter string, reason ReportReason, details string) (int, error)
+	Open(f Filter) ([]*Report, Metadata, error)
+	Resolve(snippetID, moderatorID int, decision Decision) error
+}
+
+// Report is a single abuse report, along with the snippet it is about so that
+// moderators can judge it without leaving the queue.
+type Report struct {
+	ID             int
+	SnippetID      int
+	SnippetTitle   string
+	SnippetContent string
+	SnippetUserID  int
+	Reporter       string
+	Reason         ReportReason
+	Details        string
+	Created        time.Time
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert files a report and returns the number of open reports from
+// logged-in users which the snippet now has. The reporter identifies who filed
+// the report (for example "user:1" or "ip:192.0.2.1"); filing a second report
+// for the same snippet while the first is still open returns
+// ErrDuplicateReport.
+func (m *ReportModel) Insert(snippetID int, reporter string, reason ReportReason, details string) (int, error) {
+	stmt := `INSERT INTO reports (snippet_id, reporter, reason, details, created)
+	VALUES (?, ?, ?, ?, ?)`
+	_, err := m.DB.Exec(stmt, snippetID, reporter, reason, details, now())
+	if err != nil {
+		if isUniqueViolation(err, "reports_uc_reporter", "reports.snippet_id, reports.reporter") {
+			return 0, ErrDuplicateReport
+		}
+		return 0, err
+	}
+	var count int
+	stmt = "SELECT COUNT(*) FROM reports WHERE snippet_id = ? AND decision IS NULL AND reporter LIKE 'user:%'"
+	err = m.DB.QueryRow(stmt, snippetID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Open returns the moderation queue: every report which hasn't been decided
+// on yet, oldest first. Reports of snippets which have been deleted for good
+// are left out, of the total as well.
+func (m *ReportModel) Open(f Filter) ([]*Report, Metadata, error) {
+	var total int
+	stmt := `SELECT COUNT(*) FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.decision IS NULL`
+	err := m.DB.QueryRow(stmt).Scan(&total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	stmt = `SELECT r.id, r.snippet_id, s.title, s.content, COALESCE(s.user_id, 0),
+	r.reporter, r.reason, r.details, r.created
+	FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.decision IS NULL ORDER BY r.id LIMIT ? OFFSET ?`
+	rows, err := m.DB.Query(stmt, f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	for rows.Next() {
+		r := &Report{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.SnippetTitle, &r.SnippetContent, &r.SnippetUserID,
+			&r.Reporter, &r.Reason, &r.Details, &r.Created)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reports = append(reports, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return reports, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+// Resolve records the moderator's decision on every open report for the
+// snippet. Acting on the decision (hiding the snippet, banning the author) is
+// up to the caller.
+func (m *ReportModel) Resolve(snippetID, moderatorID int, decision Decision) error {
+	stmt := `UPDATE reports SET decision = ?, moderator_id = ?, resolved = ?
+	WHERE snippet_id = ? AND decision IS NULL`
+	result, err := m.DB.Exec(stmt, decision, moderatorID, now(), snippetID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// MemoryReportModel is ReportModel for a MemoryDB.
+type MemoryReportModel struct {
+	DB *MemoryDB
+}
+
+// memoryReport is a row of the reports table. The snippet's fields of the
+// embedded Report are filled in when the report is read.
+type memoryReport struct {
+	Report
+	decision    Decision
+	moderatorID int
+	resolved    time.Time
+}
+
+// open returns the number of open reports of the snippet from logged-in
+// users. The caller must hold the lock.
+func (m *MemoryReportModel) open(snippetID int) int {
+	n := 0
+	for _, r := range m.DB.reports {
+		if r.SnippetID == snippetID && r.decision == "" && strings.HasPrefix(r.Reporter, "user:") {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemoryReportModel) Insert(snippetID int, reporter string, reason ReportReason, details string) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	for _, r := range m.DB.reports {
+		if r.SnippetID == snippetID && r.Reporter == reporter && r.decision == "" {
+			return 0, ErrDuplicateReport
+		}
+	}
+	m.DB.reports = append(m.DB.reports, &memoryReport{Report: Report{
+		ID:        m.DB.nextID("reports"),
+		SnippetID: snippetID,
+		Reporter:  reporter,
+		Reason:    reason,
+		Details:   details,
+		Created:   now(),
+	}})
+	return m.open(snippetID), nil
+}
+
+func (m *MemoryReportModel) Open(f Filter) ([]*Report, Metadata, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	total := 0
+	var reports []*Report
+	for _, r := range m.DB.reports {
+		if r.decision != "" {
+			continue
+		}
+		// Like the inner join, leave out reports of snippets which have
+		// been deleted for good.
+		for _, s := range m.DB.snippets {
+			if s.ID == r.SnippetID {
+				total++
+				c := r.Report
+				c.SnippetTitle, c.SnippetContent, c.SnippetUserID = s.Title, s.Content, s.UserID
+				reports = append(reports, &c)
+				break
+			}
+		}
+	}
+	page, _ := paginate(reports, f)
+	return page, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+func (m *MemoryReportModel) Resolve(snippetID, moderatorID int, decision Decision) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	n := 0
+	for _, r := range m.DB.reports {
+		if r.SnippetID == snippetID && r.decision == "" {
+			r.decision, r.moderatorID, r.resolved = decision, moderatorID, now()
+			n++
+		}
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"time"
+)
+
+// The session data itself lives in the sessions table, which belongs to the
+// scs session store and can't be queried by user. So for every login we also
+// record a row in user_sessions, which the user can see and revoke. The ID of
+// that row is stored in the session data under "sessionID", and the row keeps
+// the scs token of the session so that the session data can be found again.
+// The row expires at the same time as the session data, after which it is no
+// longer listed, and it is deleted by the next login.
+type SessionModelInterface interface {
+	Insert(userID int, token, userAgent, ip string, expires time.Time) (string, error)
+	Touch(id string, userID int) (bool, error)
+	ForUser(userID int) ([]*Session, error)
+	All() ([]*Session, error)
+	Tokens(userID int) ([]string, error)
+	Delete(id string, userID int) error
+	DeleteOthers(userID int, keepID string) error
+}
+
+type Session struct {
+	ID        string
+	UserID    int
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+	// token is the scs token, which is only kept by MemorySessionModel.
+	token string
+}
+
+// touchInterval stops Touch from writing to the database on every request.
+const touchInterval = time.Minute
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new login, whose scs session has the given token and lasts
+// until expires, and returns the ID of the new session. It also deletes
+// everybody's expired sessions, so that the table doesn't grow forever.
+func (m *SessionModel) Insert(userID int, token, userAgent, ip string, expires time.Time) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	userAgent = truncate(userAgent, 255)
+	at := now()
+	_, err = m.DB.Exec("DELETE FROM user_sessions WHERE expires <= ?", at)
+	if err != nil {
+		return "", err
+	}
+	stmt := `INSERT INTO user_sessions (id, user_id, token, user_agent, ip, created, last_seen, expires)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = m.DB.Exec(stmt, id, userID, token, userAgent, ip, at, at, expires.UTC().Truncate(time.Second))
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Touch reports whether the session still exists (i.e. it hasn't been
+// revoked or expired) and belongs to the user, and updates its last seen time.
+func (m *SessionModel) Touch(id string, userID int) (bool, error) {
+	var lastSeen time.Time
+	stmt := "SELECT last_seen FROM user_sessions WHERE id = ? AND user_id = ? AND expires > ?"
+	err := m.DB.QueryRow(stmt, id, userID, now()).Scan(&lastSeen)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now().UTC()
+	if now.Sub(lastSeen) > touchInterval {
+		_, err = m.DB.Exec("UPDATE user_sessions SET last_seen = ? WHERE id = ?", now, id)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ForUser returns the user's unexpired sessions, most recently used first.
+func (m *SessionModel) ForUser(userID int) ([]*Session, error) {
+	return m.query("WHERE user_id = ? AND expires > ?", userID, now())
+}
+
+// All returns everybody's unexpired sessions, most recently used first.
+func (m *SessionModel) All() ([]*Session, error) {
+	return m.query("WHERE expires > ?", now())
+}
+
+// Tokens returns the scs tokens of all of the user's sessions, so that the
+// session data can be destroyed.
+func (m *SessionModel) Tokens(userID int) ([]string, error) {
+	rows, err := m.DB.Query("SELECT token FROM user_sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []string{}
+	for rows.Next() {
+		var token string
+		err = rows.Scan(&token)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// query returns the sessions matching where, most recently used first.
+func (m *SessionModel) query(where string, args ...any) ([]*Session, error) {
+	stmt := `SELECT id, user_id, user_agent, ip, created, last_seen, expires FROM user_sessions
+	` + where + ` ORDER BY last_seen DESC`
+	rows, err := m.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		s := &Session{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete revokes one of the user's sessions. It returns ErrNoRecord if the
+// session doesn't exist or belongs to somebody else.
+func (m *SessionModel) Delete(id string, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM user_sessions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteOthers revokes all of the user's sessions except keepID. Passing an
+// empty keepID revokes all of them.
+func (m *SessionModel) DeleteOthers(userID int, keepID string) error {
+	_, err := m.DB.Exec("DELETE FROM user_sessions WHERE user_id = ? AND id <> ?", userID, keepID)
+	return err
+}
+
+// MemorySessionModel is SessionModel for a MemoryDB. The session data itself
+// is kept by scs/memstore.
+type MemorySessionModel struct {
+	DB *MemoryDB
+}
+
+// newSessionID returns a random ID for a session.
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (m *MemorySessionModel) Insert(userID int, token, userAgent, ip string, expires time.Time) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	userAgent = truncate(userAgent, 255)
+	at := now()
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	m.DB.sessions, _ = deleteWhere(m.DB.sessions, func(s *Session) bool { return !s.Expires.After(at) })
+	m.DB.sessions = append(m.DB.sessions, &Session{
+		ID:        id,
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		Created:   at,
+		LastSeen:  at,
+		Expires:   expires.UTC().Truncate(time.Second),
+		token:     token,
+	})
+	return id, nil
+}
+
+func (m *MemorySessionModel) Touch(id string, userID int) (bool, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	for _, s := range m.DB.sessions {
+		if s.ID == id && s.UserID == userID && s.Expires.After(at) {
+			if at.Sub(s.LastSeen) > touchInterval {
+				s.LastSeen = at
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sorted returns copies of the unexpired sessions for which keep returns
+// true, most recently used first.
+func (m *MemorySessionModel) sorted(keep func(*Session) bool) []*Session {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	sessions := []*Session{}
+	for _, s := range m.DB.sessions {
+		if s.Expires.After(at) && keep(s) {
+			c := *s
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeen.After(sessions[j].LastSeen) })
+	return sessions
+}
+
+func (m *MemorySessionModel) ForUser(userID int) ([]*Session, error) {
+	return m.sorted(func(s *Session) bool { return s.UserID == userID }), nil
+}
+
+func (m *MemorySessionModel) All() ([]*Session, error) {
+	return m.sorted(func(*Session) bool { return true }), nil
+}
+
+func (m *MemorySessionModel) Tokens(userID int) ([]string, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	tokens := []string{}
+	for _, s := range m.DB.sessions {
+		if s.UserID == userID {
+			tokens = append(tokens, s.token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MemorySessionModel) Delete(id string, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var n int
+	m.DB.sessions, n = deleteWhere(m.DB.sessions, func(s *Session) bool { return s.ID == id && s.UserID == userID })
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func (m *MemorySessionModel) DeleteOthers(userID int, keepID string) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	m.DB.sessions, _ = deleteWhere(m.DB.sessions, func(s *Session) bool { return s.UserID == userID && s.ID != keepID })
+	return nil
+}
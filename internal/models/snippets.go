@@ -1,15 +1,27 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
 )
 
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
+	Insert(userID int, title string, content string, expires int) (int, error)
 	Get(id int) (*Snippet, error)
+	Update(id int, title string, content string, expires int) error
+	Delete(id int) error
+	DeleteExpired() (int, error)
 	Latest() ([]*Snippet, error)
+	LatestForUser(userID int) ([]*Snippet, error)
+	ForUser(userID int) ([]*Snippet, error)
+	List(f Filter) ([]*Snippet, Metadata, error)
+	Search(f Filter) ([]*Snippet, Metadata, error)
+	SetDeleted(id int, deleted bool) error
+	SetHidden(id int, hidden bool) error
+	Owner(id int) (int, error)
+	CreatedPerDay(days int) ([]DailyCount, error)
 }
 
 // Define a Snippet type to hold the data for an individual snippet. Notice how
@@ -17,12 +29,28 @@ type SnippetModelInterface interface {
 // table?
 type Snippet struct {
 	ID      int
+	UserID  int
 	Title   string
 	Content string
 	Created time.Time
 	Expires time.Time
+	Deleted bool
+	Hidden  bool
 }
 
+// visibleSnippet is the WHERE condition shared by every public snippet query.
+// Snippets written by a deactivated user are hidden (but kept), so that they
+// come back as soon as the account is reactivated. Snippets created before
+// they were linked to users have no owner and are always visible.
+// Snippets deleted by an admin or hidden by a moderator are hidden in the same
+// way, so they can be restored.
+const visibleSnippet = `deleted IS NULL AND hidden = FALSE AND (user_id IS NULL OR user_id IN (SELECT id FROM users WHERE active = TRUE))`
+
+// Snippets have always been stamped with Taiwan time (UTC+8) while their
+// expiry is checked against UTC, which gives every snippet eight extra hours.
+// New snippets are stamped the same way so that they agree with the old ones.
+const snippetTimeOffset = 8 * time.Hour
+
 // Define a SnippetModel type which wraps a sql.DB connection pool.
 // 建立自訂 SnippetModel 類型並在其上實現方法
 type SnippetModel struct {
@@ -30,44 +58,28 @@ type SnippetModel struct {
 }
 
 // This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+func (m *SnippetModel) Insert(userID int, title string, content string, expires int) (int, error) {
 	// Write the SQL statement we want to execute.
-	stmt := `INSERT INTO snippets (title, content, created, expires) 
-	VALUES(?, ?
-	, CONVERT_TZ(UTC_TIMESTAMP(), '+00:00', '+08:00')
-	, DATE_ADD(CONVERT_TZ(UTC_TIMESTAMP(), '+00:00', '+08:00')
-	, INTERVAL ? DAY))`
-	// Use the Exec() method on the embedded connection pool to execute the
-	// statement. The first parameter is the SQL statement, followed by the
-	// title, content and expiry values for the placeholder parameters. This
-	// method returns a sql.Result type, which contains some basic
-	// information about what happened when the statement was executed.
-	result, err := m.DB.Exec(stmt, title, content, expires)
-	if err != nil {
-		return 0, err
-	}
-	// Use the LastInsertId() method on the result to get the ID of our
-	// newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-	// The ID returned has the type int64, so we convert it to an int type
-	// before returning.
-	return int(id), nil
+	stmt := `INSERT INTO snippets (user_id, title, content, created, expires)
+	VALUES(?, ?, ?, ?, ?)`
+	created := now().Add(snippetTimeOffset)
+	// insertID executes the statement, with the user, title, content and
+	// expiry values for the placeholder parameters, and returns the ID of
+	// our newly inserted record in the snippets table.
+	return insertID(context.Background(), dialectOf(m.DB), m.DB, stmt, userID, title, content, created, created.AddDate(0, 0, expires))
 }
 
 // This will return a specific snippet based on its id.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// Write the SQL statement we want to execute. Again, I've split it over two
 	// lines for readability.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-	WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT id, COALESCE(user_id, 0), title, content, created, expires FROM snippets
+	WHERE expires > ? AND id = ? AND ` + visibleSnippet
 	// Use the QueryRow() method on the connection pool to execute our
 	// SQL statement, passing in the untrusted id variable as the value for the
 	// placeholder parameter. This returns a pointer to a sql.Row object which
 	// holds the result from the database.
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRow(stmt, now(), id)
 	// Initialize a pointer to a new zeroed Snippet struct.
 	s := &Snippet{}
 	// Use row.Scan() to copy the values from each field in sql.Row to the
@@ -75,7 +87,7 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// row.Scan are *pointers* to the place you want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
 	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error.
@@ -96,12 +108,12 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
-	stmt := `SELECT id, title, content, created, expires FROM snippets 
-	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT id, COALESCE(user_id, 0), title, content, created, expires FROM snippets 
+	WHERE expires > ? AND ` + visibleSnippet + ` ORDER BY id DESC LIMIT 10`
 	// Use the Query() method on the connection pool to execute our
 	// SQL statement. This returns a sql.Rows resultset containing the result of
 	// our query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.Query(stmt, now())
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +131,7 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 		// Create a pointer to a new zeroed Snippet struct.
 		s := &Snippet{}
 
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires)
 		if err != nil {
 			return nil, err
 		}
@@ -136,3 +148,416 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	return snippets, nil
 }
+
+// LatestForUser is Latest for the snippets of a single user.
+func (m *SnippetModel) LatestForUser(userID int) ([]*Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, expires FROM snippets
+	WHERE expires > ? AND user_id = ? AND ` + visibleSnippet + ` ORDER BY id DESC LIMIT 10`
+	rows, err := m.DB.Query(stmt, now(), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// ForUser returns every snippet owned by the user, including expired ones,
+// oldest first. It is used to export a user's data.
+func (m *SnippetModel) ForUser(userID int) ([]*Snippet, error) {
+	stmt := `SELECT id, user_id, title, content, created, expires FROM snippets
+	WHERE user_id = ? ORDER BY id`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+// List returns every snippet whose title matches the filter, newest first,
+// including expired, hidden and deleted ones. It is meant for admins.
+func (m *SnippetModel) List(f Filter) ([]*Snippet, Metadata, error) {
+	var total int
+	stmt := "SELECT COUNT(*) FROM snippets WHERE title LIKE ?"
+	err := m.DB.QueryRow(ilike(m.DB, stmt), f.likePattern()).Scan(&total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	stmt = `SELECT id, COALESCE(user_id, 0), title, content, created, expires, deleted IS NOT NULL, hidden
+	FROM snippets WHERE title LIKE ? ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.Query(ilike(m.DB, stmt), f.likePattern(), f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Deleted, &s.Hidden)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return snippets, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+// Search is List for the public: it only finds snippets which anybody could
+// see, and it looks for the query in the content as well as the title.
+func (m *SnippetModel) Search(f Filter) ([]*Snippet, Metadata, error) {
+	where := ilike(m.DB, `WHERE expires > ? AND (title LIKE ? OR content LIKE ?) AND `+visibleSnippet)
+	at := now()
+	var total int
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM snippets "+where, at, f.likePattern(), f.likePattern()).Scan(&total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	stmt := "SELECT id, COALESCE(user_id, 0), title, content, created, expires FROM snippets " +
+		where + " ORDER BY id DESC LIMIT ? OFFSET ?"
+	rows, err := m.DB.Query(stmt, at, f.likePattern(), f.likePattern(), f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return snippets, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+// SetDeleted soft-deletes or restores a snippet. Deleted snippets are hidden
+// everywhere except in List. It returns ErrNoRecord if there is no such
+// snippet.
+func (m *SnippetModel) SetDeleted(id int, deleted bool) error {
+	var result sql.Result
+	var err error
+	if deleted {
+		result, err = m.DB.Exec("UPDATE snippets SET deleted = ? WHERE id = ? AND deleted IS NULL", now(), id)
+	} else {
+		result, err = m.DB.Exec("UPDATE snippets SET deleted = NULL WHERE id = ?", id)
+	}
+	if err != nil {
+		return err
+	}
+	return m.updated(result, id)
+}
+
+// Update replaces the title and content of a snippet, and sets it to expire
+// the given number of days from now (in the same time zone as Insert). It
+// returns ErrNoRecord if there is no such snippet.
+func (m *SnippetModel) Update(id int, title string, content string, expires int) error {
+	stmt := "UPDATE snippets SET title = ?, content = ?, expires = ? WHERE id = ?"
+	result, err := m.DB.Exec(stmt, title, content, now().Add(snippetTimeOffset).AddDate(0, 0, expires), id)
+	if err != nil {
+		return err
+	}
+	return m.updated(result, id)
+}
+
+// updated returns ErrNoRecord if the UPDATE which gave result changed no rows
+// because there is no snippet with the ID. An UPDATE which leaves a snippet
+// as it was changes no rows either, on MySQL, which only counts the rows that
+// actually changed, and in SetDeleted.
+func (m *SnippetModel) updated(result sql.Result, id int) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err = m.Owner(id)
+	return err
+}
+
+// Delete removes a snippet for good. Unlike SetDeleted, which is used by
+// admins, it can't be undone.
+func (m *SnippetModel) Delete(id int) error {
+	result, err := m.DB.Exec("DELETE FROM snippets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteExpired deletes every snippet which has expired, and returns how many
+// there were. Expired snippets are never shown, but they stay in the table
+// until this is run.
+func (m *SnippetModel) DeleteExpired() (int, error) {
+	result, err := m.DB.Exec("DELETE FROM snippets WHERE expires <= ?", now())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// SetHidden hides a snippet pending moderation, or makes it visible again. It
+// returns ErrNoRecord if there is no such snippet.
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	result, err := m.DB.Exec("UPDATE snippets SET hidden = ? WHERE id = ?", hidden, id)
+	if err != nil {
+		return err
+	}
+	return m.updated(result, id)
+}
+
+// Owner returns the ID of the snippet's author, whether or not the snippet is
+// visible. It returns zero for snippets which have no author.
+func (m *SnippetModel) Owner(id int) (int, error) {
+	var userID int
+	err := m.DB.QueryRow("SELECT COALESCE(user_id, 0) FROM snippets WHERE id = ?", id).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// CreatedPerDay returns the number of snippets created on each of the last n
+// days.
+func (m *SnippetModel) CreatedPerDay(days int) ([]DailyCount, error) {
+	return countPerDay(m.DB, "snippets", days)
+}
+
+// MemorySnippetModel is SnippetModel for a MemoryDB.
+type MemorySnippetModel struct {
+	DB *MemoryDB
+}
+
+// row returns a copy of the snippet with the columns which the SQL queries
+// select, leaving out the Deleted and Hidden flags unless all is set.
+func (s *Snippet) row(all bool) *Snippet {
+	c := *s
+	if !all {
+		c.Deleted, c.Hidden = false, false
+	}
+	return &c
+}
+
+func (m *MemorySnippetModel) Insert(userID int, title string, content string, expires int) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	created := now().Add(snippetTimeOffset)
+	s := &Snippet{
+		ID:      m.DB.nextID("snippets"),
+		UserID:  userID,
+		Title:   title,
+		Content: content,
+		Created: created,
+		Expires: created.AddDate(0, 0, expires),
+	}
+	m.DB.snippets = append(m.DB.snippets, s)
+	return s.ID, nil
+}
+
+// snippet returns the snippet with the given ID, or nil. The caller must hold
+// the lock.
+func (m *MemorySnippetModel) snippet(id int) *Snippet {
+	for _, s := range m.DB.snippets {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (m *MemorySnippetModel) Get(id int) (*Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	s := m.snippet(id)
+	if s == nil || !m.DB.visible(s, now()) {
+		return nil, ErrNoRecord
+	}
+	return s.row(false), nil
+}
+
+// latest returns the ten newest visible snippets for which keep returns true.
+func (m *MemorySnippetModel) latest(keep func(*Snippet) bool) []*Snippet {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	snippets := []*Snippet{}
+	for i := len(m.DB.snippets) - 1; i >= 0 && len(snippets) < 10; i-- {
+		s := m.DB.snippets[i]
+		if keep(s) && m.DB.visible(s, at) {
+			snippets = append(snippets, s.row(false))
+		}
+	}
+	return snippets
+}
+
+func (m *MemorySnippetModel) Latest() ([]*Snippet, error) {
+	return m.latest(func(*Snippet) bool { return true }), nil
+}
+
+func (m *MemorySnippetModel) LatestForUser(userID int) ([]*Snippet, error) {
+	return m.latest(func(s *Snippet) bool { return s.UserID == userID }), nil
+}
+
+func (m *MemorySnippetModel) ForUser(userID int) ([]*Snippet, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	snippets := []*Snippet{}
+	for _, s := range m.DB.snippets {
+		if s.UserID == userID {
+			snippets = append(snippets, s.row(false))
+		}
+	}
+	return snippets, nil
+}
+
+func (m *MemorySnippetModel) List(f Filter) ([]*Snippet, Metadata, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var snippets []*Snippet
+	for i := len(m.DB.snippets) - 1; i >= 0; i-- {
+		s := m.DB.snippets[i]
+		if f.matches(s.Title) {
+			snippets = append(snippets, s.row(true))
+		}
+	}
+	page, metadata := paginate(snippets, f)
+	return page, metadata, nil
+}
+
+func (m *MemorySnippetModel) Search(f Filter) ([]*Snippet, Metadata, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	var snippets []*Snippet
+	for i := len(m.DB.snippets) - 1; i >= 0; i-- {
+		s := m.DB.snippets[i]
+		if f.matches(s.Title, s.Content) && m.DB.visible(s, at) {
+			snippets = append(snippets, s.row(false))
+		}
+	}
+	page, metadata := paginate(snippets, f)
+	return page, metadata, nil
+}
+
+func (m *MemorySnippetModel) SetDeleted(id int, deleted bool) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	s := m.snippet(id)
+	if s == nil {
+		return ErrNoRecord
+	}
+	s.Deleted = deleted
+	return nil
+}
+
+func (m *MemorySnippetModel) Update(id int, title string, content string, expires int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	s := m.snippet(id)
+	if s == nil {
+		return ErrNoRecord
+	}
+	s.Title = title
+	s.Content = content
+	s.Expires = now().Add(snippetTimeOffset).AddDate(0, 0, expires)
+	return nil
+}
+
+func (m *MemorySnippetModel) Delete(id int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var n int
+	m.DB.snippets, n = deleteWhere(m.DB.snippets, func(s *Snippet) bool { return s.ID == id })
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func (m *MemorySnippetModel) DeleteExpired() (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	var n int
+	m.DB.snippets, n = deleteWhere(m.DB.snippets, func(s *Snippet) bool { return !s.Expires.After(at) })
+	return n, nil
+}
+
+func (m *MemorySnippetModel) SetHidden(id int, hidden bool) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	s := m.snippet(id)
+	if s == nil {
+		return ErrNoRecord
+	}
+	s.Hidden = hidden
+	return nil
+}
+
+func (m *MemorySnippetModel) Owner(id int) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	s := m.snippet(id)
+	if s == nil {
+		return 0, ErrNoRecord
+	}
+	return s.UserID, nil
+}
+
+func (m *MemorySnippetModel) CreatedPerDay(days int) ([]DailyCount, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	created := make([]time.Time, 0, len(m.DB.snippets))
+	for _, s := range m.DB.snippets {
+		created = append(created, s.Created)
+	}
+	return countCreatedPerDay(created, days), nil
+}
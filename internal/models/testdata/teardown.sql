@@ -1,5 +0,0 @@
-USE test_snippetbox;
-
-DROP TABLE IF EXISTS users;
-
-DROP TABLE IF EXISTS snippets;
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// TokenScope limits what an API token can be used for. Write tokens can read
+// as well.
+type TokenScope string
+
+const (
+	ScopeRead  TokenScope = "read"
+	ScopeWrite TokenScope = "write"
+)
+
+var TokenScopes = []TokenScope{ScopeRead, ScopeWrite}
+
+// Allows reports whether a token with this scope may be used for an action
+// needing the given scope.
+func (s TokenScope) Allows(needed TokenScope) bool {
+	return s == needed || s == ScopeWrite
+}
+
+// TokenPrefix starts every API token, so that they are easy to recognise (for
+// example by secret scanners).
+const TokenPrefix = "sbx_"
+
+// Personal API tokens let users call the JSON API from scripts. Only a hash
+// of each token is stored: the token itself is returned once by Insert and
+// can't be recovered afterwards.
+type TokenModelInterface interface {
+	Insert(userID int, name string, scope TokenScope, expires time.Time) (string, error)
+	ForUser(userID int) ([]*APIToken, error)
+	Delete(id, userID int) error
+	DeleteAll(userID int) (int, error)
+	Authenticate(token string) (*APIToken, error)
+}
+
+// APIToken describes a token without the secret part. Expires and LastUsed
+// are zero for tokens which never expire or have never been used.
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    TokenScope
+	Created  time.Time
+	Expires  time.Time
+	LastUsed time.Time
+}
+
+// HashToken returns the form in which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a token and returns it. Pass a zero expires for a token
+// which doesn't expire.
+func (m *TokenModel) Insert(userID int, name string, scope TokenScope, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	var expiresAt sql.NullTime
+	if !expires.IsZero() {
+		expiresAt = sql.NullTime{Time: expires.UTC(), Valid: true}
+	}
+	stmt := `INSERT INTO api_tokens (user_id, name, scope, token_hash, created, expires)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = m.DB.Exec(stmt, userID, name, scope, HashToken(token), now(), expiresAt)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+const tokenColumns = "id, user_id, name, scope, created, expires, last_used"
+
+func scanToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	t := &APIToken{}
+	var expires, lastUsed sql.NullTime
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &expires, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	t.Expires = expires.Time
+	t.LastUsed = lastUsed.Time
+	return t, nil
+}
+
+// ForUser returns the user's tokens, newest first, including expired ones.
+func (m *TokenModel) ForUser(userID int) ([]*APIToken, error) {
+	stmt := "SELECT " + tokenColumns + " FROM api_tokens WHERE user_id = ? ORDER BY id DESC"
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes one of the user's tokens. It returns ErrNoRecord if the token
+// doesn't exist or belongs to somebody else.
+func (m *TokenModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// DeleteAll revokes all of the user's tokens, and returns how many there were.
+func (m *TokenModel) DeleteAll(userID int) (int, error) {
+	result, err := m.DB.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Authenticate looks up a token and records that it has been used. It returns
+// ErrNoRecord if the token doesn't exist, has been revoked or has expired.
+// Whether the owner's account is still active is up to the caller.
+func (m *TokenModel) Authenticate(token string) (*APIToken, error) {
+	stmt := "SELECT " + tokenColumns + ` FROM api_tokens
+	WHERE token_hash = ? AND (expires IS NULL OR expires > ?)`
+	t, err := scanToken(m.DB.QueryRow(stmt, HashToken(token), now()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	// Like SessionModel.Touch, only write when the last use is getting stale.
+	now := time.Now().UTC()
+	if now.Sub(t.LastUsed) > touchInterval {
+		_, err = m.DB.Exec("UPDATE api_tokens SET last_used = ? WHERE id = ?", now, t.ID)
+		if err != nil {
+			return nil, err
+		}
+		t.LastUsed = now
+	}
+	return t, nil
+}
+
+// MemoryTokenModel is TokenModel for a MemoryDB.
+type MemoryTokenModel struct {
+	DB *MemoryDB
+}
+
+// memoryToken is a row of the api_tokens table.
+type memoryToken struct {
+	APIToken
+	hash string
+}
+
+func (m *MemoryTokenModel) Insert(userID int, name string, scope TokenScope, expires time.Time) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	if !expires.IsZero() {
+		expires = expires.UTC().Truncate(time.Second)
+	}
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	m.DB.tokens = append(m.DB.tokens, &memoryToken{
+		APIToken: APIToken{
+			ID:      m.DB.nextID("api_tokens"),
+			UserID:  userID,
+			Name:    name,
+			Scope:   scope,
+			Created: now(),
+			Expires: expires,
+		},
+		hash: HashToken(token),
+	})
+	return token, nil
+}
+
+func (m *MemoryTokenModel) ForUser(userID int) ([]*APIToken, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	tokens := []*APIToken{}
+	for i := len(m.DB.tokens) - 1; i >= 0; i-- {
+		if t := m.DB.tokens[i]; t.UserID == userID {
+			c := t.APIToken
+			tokens = append(tokens, &c)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *MemoryTokenModel) Delete(id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var n int
+	m.DB.tokens, n = deleteWhere(m.DB.tokens, func(t *memoryToken) bool { return t.ID == id && t.UserID == userID })
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+func (m *MemoryTokenModel) DeleteAll(userID int) (int, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var n int
+	m.DB.tokens, n = deleteWhere(m.DB.tokens, func(t *memoryToken) bool { return t.UserID == userID })
+	return n, nil
+}
+
+func (m *MemoryTokenModel) Authenticate(token string) (*APIToken, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	hash := HashToken(token)
+	at := time.Now().UTC()
+	for _, t := range m.DB.tokens {
+		if t.hash != hash {
+			continue
+		}
+		if !t.Expires.IsZero() && !t.Expires.After(at) {
+			break
+		}
+		if at.Sub(t.LastUsed) > touchInterval {
+			t.LastUsed = at
+		}
+		c := t.APIToken
+		return &c, nil
+	}
+	return nil, ErrNoRecord
+}
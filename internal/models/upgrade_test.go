@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"GoWebPractice/internal/assert"
+	"GoWebPractice/internal/migrations"
+)
+
+// readmeSchema is the schema which used to be in the README, which databases
+// were created from by hand before there were migrations.
+var readmeSchema = []string{
+	`CREATE TABLE snippets (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  title VARCHAR(100) NOT NULL,
+  content TEXT NOT NULL,
+  created DATETIME NOT NULL,
+  expires DATETIME NOT NULL
+)`,
+	`CREATE INDEX idx_snippets_created ON snippets(created)`,
+	`CREATE TABLE sessions (
+  token CHAR(43) PRIMARY KEY,
+  data BLOB NOT NULL,
+  expiry TIMESTAMP(6) NOT NULL
+)`,
+	`CREATE INDEX sessions_expiry_idx ON sessions (expiry)`,
+	`CREATE TABLE users (
+  id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  hashed_password CHAR(60) NOT NULL,
+  created DATETIME NOT NULL
+)`,
+	`ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email)`,
+}
+
+// sqliteSchema translates the README schema for SQLite.
+func sqliteSchema(schema []string) []string {
+	var translated []string
+	for _, stmt := range schema {
+		stmt = strings.ReplaceAll(stmt, "AUTO_INCREMENT", "AUTOINCREMENT")
+		stmt = strings.ReplaceAll(stmt, "ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email)", "CREATE UNIQUE INDEX users_uc_email ON users (email)")
+		translated = append(translated, stmt)
+	}
+	return translated
+}
+
+// TestUpgradeREADMESchema checks that "migrate up" brings a database created
+// from the README schema up to date, keeping its data.
+func TestUpgradeREADMESchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		driver      string
+		integration bool
+		open        func(t *testing.T) *sql.DB
+		// schema is what was done by hand before the migrations.
+		schema []string
+	}{
+		{
+			// SQLite has no hand-built databases, but it checks the same
+			// upgrade without a server. It spells two statements differently.
+			name:   "sqlite",
+			driver: "sqlite",
+			open: func(t *testing.T) *sql.DB {
+				db, err := sql.Open("sqlite", SQLiteDSN(filepath.Join(t.TempDir(), "test.db")))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return db
+			},
+			schema: sqliteSchema(readmeSchema),
+		},
+		{
+			// The README also told people to add the columns which came
+			// later by hand; this database had the first of them added.
+			name:        "mysql",
+			driver:      "mysql",
+			integration: true,
+			open:        openTestMySQL,
+			schema: append(readmeSchema[:len(readmeSchema):len(readmeSchema)],
+				`ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.integration && testing.Short() {
+				t.Skip("models: skipping integration test")
+			}
+			db := tt.open(t)
+			t.Cleanup(func() {
+				all, err := migrations.All(tt.driver)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = migrations.Down(db, tt.driver, len(all))
+				if err != nil {
+					t.Fatal(err)
+				}
+				db.Close()
+			})
+
+			for _, stmt := range tt.schema {
+				_, err := db.Exec(stmt)
+				assert.NilError(t, err)
+			}
+			created := time.Now().UTC().Truncate(time.Second)
+			_, err := db.Exec(`INSERT INTO users (name, email, hashed_password, created) VALUES (?, ?, ?, ?)`,
+				"Alice", "alice@example.com", testPasswordHash, created)
+			assert.NilError(t, err)
+			_, err = db.Exec(`INSERT INTO snippets (title, content, created, expires) VALUES (?, ?, ?, ?)`,
+				"O snail", "Climb Mount Fuji", created, created.Add(24*time.Hour))
+			assert.NilError(t, err)
+
+			_, err = migrations.Up(db, tt.driver)
+			assert.NilError(t, err)
+
+			// The existing rows get the defaults of the new columns, and the
+			// models, which use all of them, can read them.
+			b := sqlBackend(db)
+			user, err := b.users.Get(1)
+			assert.NilError(t, err)
+			assert.Equal(t, user.Active, true)
+			assert.Equal(t, user.Role, RoleUser)
+			snippet, err := b.snippets.Get(1)
+			assert.NilError(t, err)
+			assert.Equal(t, snippet.UserID, 0)
+			assert.Equal(t, snippet.Title, "O snail")
+		})
+	}
+}
@@ -3,10 +3,10 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"strings"
+	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,9 +18,41 @@ type UserModelInterface interface {
 	Authenticate(email, password string) (int, error)
 	Exists(id int) (bool, error)
 	Get(id int) (*User, error)
+	GetByEmail(email string) (*User, error)
 	PasswordUpdate(id int, currentPassword, newPassword string) error
+	SetPassword(id int, password string) error
+	CheckPassword(id int, password string) error
+	SetActive(id int, active bool) error
+	SetRole(id int, role Role) error
+	List(f Filter) ([]*User, Metadata, error)
+	SignupsPerDay(days int) ([]DailyCount, error)
+	Delete(id int, policy DeletionPolicy) error
 }
 
+// DeletionPolicy decides what happens to the data a user owns when their
+// account is deleted.
+type DeletionPolicy string
+
+const (
+	// DeleteCascade deletes everything the user owns along with the account.
+	DeleteCascade DeletionPolicy = "cascade"
+	// DeleteAnonymise keeps the user's snippets but removes the link back to
+	// the deleted account.
+	DeleteAnonymise DeletionPolicy = "anonymise"
+)
+
+// Role decides what a user is allowed to do. Every user has exactly one role.
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists every valid role, from least to most privileged.
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
 // Define a new User type. Notice how the field names and types align
 // with the columns in the database "users" table?
 type User struct {
@@ -29,6 +61,18 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Active         bool
+	Role           Role
+}
+
+// HasRole reports whether the user has one of the given roles.
+func (u *User) HasRole(roles ...Role) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
 }
 
 // Define a new UserModel type which wraps a database connection pool.
@@ -42,21 +86,15 @@ func (m *UserModel) Insert(name, email, password string) error {
 	if err != nil {
 		return err
 	}
-	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, ?)`
 	// Use the Exec() method to insert the user details and hashed password // into the users table.
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
-	if err != nil {
-		// If this returns an error, we use the errors.As() function to check
-		// whether the error has the type *mysql.MySQLError. If it does, the
-		// error will be assigned to the mySQLError variable. We can then check
-		// whether or not the error relates to our users_uc_email key by
-		// checking if the error code equals 1062 and the contents of the error
-		// message string. If it does, we return an ErrDuplicateEmail error.
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword), now())
+	if err != nil {
+		// If this returns an error, we check whether the error relates to our
+		// users_uc_email key (see isUniqueViolation for how each database
+		// reports it). If it does, we return an ErrDuplicateEmail error.
+		if isUniqueViolation(err, "users_uc_email", "users.email") {
+			return ErrDuplicateEmail
 		}
 		return err
 	}
@@ -67,8 +105,9 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	// Retrieve the id and hashed password associated with the given email. If // no matching email exists we return the ErrInvalidCredentials error.
 	var id int
 	var hashedPassword []byte
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	var active bool
+	stmt := "SELECT id, hashed_password, active FROM users WHERE email = ?"
+	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword, &active)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -85,21 +124,43 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 			return 0, err
 		}
 	}
+	// The password is correct, but a deactivated account still can't log in.
+	// We only reveal this after the password has been checked, so it can't be
+	// used to find out which accounts exist.
+	if !active {
+		return 0, ErrInactiveAccount
+	}
 	// Otherwise, the password is correct. Return the user ID.
 	return id, nil
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
 	var exists bool
-	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ? AND active = TRUE)"
 	err := m.DB.QueryRow(stmt, id).Scan(&exists)
 	return exists, err
 }
 
 func (m *UserModel) Get(id int) (*User, error) {
 	var user User
-	stmt := `SELECT id, name, email, created FROM users WHERE id = ?`
-	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
+	stmt := `SELECT id, name, email, created, active, role FROM users WHERE id = ?`
+	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Active, &user.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetByEmail is Get for when only the email address is known. Unlike
+// Authenticate, it finds deactivated users too.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	var user User
+	stmt := `SELECT id, name, email, created, active, role FROM users WHERE email = ?`
+	err := m.DB.QueryRow(stmt, email).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Active, &user.Role)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -125,11 +186,387 @@ func (m *UserModel) PasswordUpdate(id int, currentPassword, newPassword string)
 			return err
 		}
 	}
-	newHashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), 12)
+	return m.SetPassword(id, newPassword)
+}
+
+// SetPassword replaces a user's password without asking for the current one.
+// It is for operators resetting forgotten passwords; users go through
+// PasswordUpdate.
+func (m *UserModel) SetPassword(id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+	stmt := "UPDATE users SET hashed_password = ? WHERE id = ?"
+	result, err := m.DB.Exec(stmt, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// CheckPassword returns ErrInvalidCredentials unless the password belongs to
+// the user. It is used to confirm sensitive actions by a logged-in user.
+func (m *UserModel) CheckPassword(id int, password string) error {
+	var hashedPassword []byte
+	stmt := "SELECT hashed_password FROM users WHERE id = ?"
+	err := m.DB.QueryRow(stmt, id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCredentials
+		} else {
+			return err
+		}
+	}
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// SetActive deactivates or reactivates a user. Nothing else is touched, so
+// reactivating an account brings back everything it owned.
+func (m *UserModel) SetActive(id int, active bool) error {
+	stmt := "UPDATE users SET active = ? WHERE id = ?"
+	_, err := m.DB.Exec(stmt, active, id)
+	return err
+}
+
+// SetRole changes the role of a user.
+func (m *UserModel) SetRole(id int, role Role) error {
+	stmt := "UPDATE users SET role = ? WHERE id = ?"
+	_, err := m.DB.Exec(stmt, role, id)
+	return err
+}
+
+// Delete removes a user, and deletes or anonymises their snippets according to
+// the policy. Everything happens in one transaction so that we never end up with
+// snippets pointing at a user who no longer exists. The reports which the user
+// filed go too, as do the reports of any snippets which are deleted.
+func (m *UserModel) Delete(id int, policy DeletionPolicy) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM reports WHERE reporter = ?", "user:"+strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	switch policy {
+	case DeleteCascade:
+		_, err = tx.Exec("DELETE FROM reports WHERE snippet_id IN (SELECT id FROM snippets WHERE user_id = ?)", id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM snippets WHERE user_id = ?", id)
+	case DeleteAnonymise:
+		_, err = tx.Exec("UPDATE snippets SET user_id = NULL WHERE user_id = ?", id)
+	default:
+		err = fmt.Errorf("models: unknown deletion policy %q", policy)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM user_sessions WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM api_tokens WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM webhooks WHERE user_id = ?", id)
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
+}
+
+// List returns the users whose name or email matches the filter, newest
+// first. It is meant for admins.
+func (m *UserModel) List(f Filter) ([]*User, Metadata, error) {
+	var total int
+	stmt := "SELECT COUNT(*) FROM users WHERE name LIKE ? OR email LIKE ?"
+	err := m.DB.QueryRow(ilike(m.DB, stmt), f.likePattern(), f.likePattern()).Scan(&total)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	stmt = `SELECT id, name, email, created, active, role FROM users
+	WHERE name LIKE ? OR email LIKE ? ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.Query(ilike(m.DB, stmt), f.likePattern(), f.likePattern(), f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Active, &u.Role)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	return users, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+// SignupsPerDay returns the number of users who signed up on each of the last
+// n days.
+func (m *UserModel) SignupsPerDay(days int) ([]DailyCount, error) {
+	return countPerDay(m.DB, "users", days)
+}
+
+// MemoryUserModel is UserModel for a MemoryDB.
+type MemoryUserModel struct {
+	DB *MemoryDB
+}
+
+// row returns a copy of the user without the password hash, like the SQL
+// queries which return users.
+func (u *User) row() *User {
+	c := *u
+	c.HashedPassword = nil
+	return &c
+}
+
+// byEmail returns the user with the given email address, or nil. The caller
+// must hold the lock.
+func (m *MemoryUserModel) byEmail(email string) *User {
+	for _, u := range m.DB.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *MemoryUserModel) Insert(name, email, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	if m.byEmail(email) != nil {
+		return ErrDuplicateEmail
+	}
+	m.DB.users = append(m.DB.users, &User{
+		ID:             m.DB.nextID("users"),
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        now(),
+		Active:         true,
+		Role:           RoleUser,
+	})
+	return nil
+}
+
+func (m *MemoryUserModel) Authenticate(email, password string) (int, error) {
+	m.DB.mu.Lock()
+	u := m.byEmail(email)
+	var id int
+	var hashedPassword []byte
+	var active bool
+	if u != nil {
+		id, hashedPassword, active = u.ID, u.HashedPassword, u.Active
+	}
+	m.DB.mu.Unlock()
+	if u == nil {
+		return 0, ErrInvalidCredentials
+	}
+	// Compare the passwords without holding the lock, since bcrypt is slow
+	// on purpose.
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	if !active {
+		return 0, ErrInactiveAccount
+	}
+	return id, nil
+}
+
+func (m *MemoryUserModel) Exists(id int) (bool, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	u := m.DB.user(id)
+	return u != nil && u.Active, nil
+}
+
+func (m *MemoryUserModel) Get(id int) (*User, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	u := m.DB.user(id)
+	if u == nil {
+		return nil, ErrNoRecord
+	}
+	return u.row(), nil
+}
+
+func (m *MemoryUserModel) GetByEmail(email string) (*User, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	u := m.byEmail(email)
+	if u == nil {
+		return nil, ErrNoRecord
+	}
+	return u.row(), nil
+}
+
+func (m *MemoryUserModel) PasswordUpdate(id int, currentPassword, newPassword string) error {
+	err := m.CheckPassword(id, currentPassword)
 	if err != nil {
 		return err
 	}
-	stmt = "UPDATE users SET hashed_password = ? WHERE id = ?"
-	_, err = m.DB.Exec(stmt, string(newHashedPassword), id)
+	return m.SetPassword(id, newPassword)
+}
+
+func (m *MemoryUserModel) SetPassword(id int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	u := m.DB.user(id)
+	if u == nil {
+		return ErrNoRecord
+	}
+	u.HashedPassword = hashedPassword
+	return nil
+}
+
+func (m *MemoryUserModel) CheckPassword(id int, password string) error {
+	m.DB.mu.Lock()
+	u := m.DB.user(id)
+	var hashedPassword []byte
+	if u != nil {
+		hashedPassword = u.HashedPassword
+	}
+	m.DB.mu.Unlock()
+	if u == nil {
+		return ErrInvalidCredentials
+	}
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrInvalidCredentials
+	}
 	return err
 }
+
+func (m *MemoryUserModel) SetActive(id int, active bool) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	if u := m.DB.user(id); u != nil {
+		u.Active = active
+	}
+	return nil
+}
+
+func (m *MemoryUserModel) SetRole(id int, role Role) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	if u := m.DB.user(id); u != nil {
+		u.Role = role
+	}
+	return nil
+}
+
+func (m *MemoryUserModel) List(f Filter) ([]*User, Metadata, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var users []*User
+	for i := len(m.DB.users) - 1; i >= 0; i-- {
+		u := m.DB.users[i]
+		if f.matches(u.Name, u.Email) {
+			users = append(users, u.row())
+		}
+	}
+	page, metadata := paginate(users, f)
+	return page, metadata, nil
+}
+
+func (m *MemoryUserModel) SignupsPerDay(days int) ([]DailyCount, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	created := make([]time.Time, 0, len(m.DB.users))
+	for _, u := range m.DB.users {
+		created = append(created, u.Created)
+	}
+	return countCreatedPerDay(created, days), nil
+}
+
+// Delete does the same as UserModel.Delete. Holding the lock throughout
+// stands in for the transaction.
+func (m *MemoryUserModel) Delete(id int, policy DeletionPolicy) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	if policy != DeleteCascade && policy != DeleteAnonymise {
+		return fmt.Errorf("models: unknown deletion policy %q", policy)
+	}
+	if m.DB.user(id) == nil {
+		return ErrNoRecord
+	}
+
+	reporter := "user:" + strconv.Itoa(id)
+	m.DB.reports, _ = deleteWhere(m.DB.reports, func(r *memoryReport) bool { return r.Reporter == reporter })
+	if policy == DeleteCascade {
+		snippetIDs := map[int]bool{}
+		m.DB.snippets, _ = deleteWhere(m.DB.snippets, func(s *Snippet) bool {
+			snippetIDs[s.ID] = s.UserID == id
+			return s.UserID == id
+		})
+		m.DB.reports, _ = deleteWhere(m.DB.reports, func(r *memoryReport) bool { return snippetIDs[r.SnippetID] })
+	} else {
+		for _, s := range m.DB.snippets {
+			if s.UserID == id {
+				s.UserID = 0
+			}
+		}
+	}
+	m.DB.sessions, _ = deleteWhere(m.DB.sessions, func(s *Session) bool { return s.UserID == id })
+	m.DB.tokens, _ = deleteWhere(m.DB.tokens, func(t *memoryToken) bool { return t.UserID == id })
+	webhookIDs := map[int]bool{}
+	m.DB.webhooks, _ = deleteWhere(m.DB.webhooks, func(h *Webhook) bool {
+		webhookIDs[h.ID] = h.UserID == id
+		return h.UserID == id
+	})
+	m.DB.deliveries, _ = deleteWhere(m.DB.deliveries, func(d *WebhookDelivery) bool { return webhookIDs[d.WebhookID] })
+	m.DB.users, _ = deleteWhere(m.DB.users, func(u *User) bool { return u.ID == id })
+	return nil
+}
@@ -18,7 +18,8 @@ func TestUserModelExists(t *testing.T) {
 	}{
 		{name: "Valid ID", userID: 1, want: true},
 		{name: "Zero ID", userID: 0, want: false},
-		{name: "Non-existent ID", userID: 2, want: false}}
+		{name: "Inactive ID", userID: 2, want: false},
+		{name: "Non-existent ID", userID: 3, want: false}}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,542 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WebhookEvent names the kind of event a webhook delivery is about.
+type WebhookEvent string
+
+const (
+	EventSnippetCreated WebhookEvent = "snippet.created"
+	EventSnippetUpdated WebhookEvent = "snippet.updated"
+	EventSnippetDeleted WebhookEvent = "snippet.deleted"
+	// EventWebhookTest is only sent when the owner asks for a test event.
+	EventWebhookTest WebhookEvent = "webhook.test"
+)
+
+// DeliveryStatus is where a delivery is in its life: pending deliveries are
+// waiting for their next attempt, the others are finished.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// A delivery is given up after MaxWebhookAttempts. The wait before each retry
+// doubles, starting at webhookRetryDelay, so the last retry happens a bit over
+// an hour after the first attempt.
+const (
+	MaxWebhookAttempts = 8
+	webhookRetryDelay  = 30 * time.Second
+)
+
+// WebhookBackoff returns how long to wait before retrying a delivery which
+// has failed the given number of times.
+func WebhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	return webhookRetryDelay << (attempts - 1)
+}
+
+// Webhooks are URLs which receive the events of their owner's snippets.
+// Events are queued in the database by Enqueue and sent later by a worker,
+// which takes due deliveries with Claim and stores the outcome with Save.
+type WebhookModelInterface interface {
+	Insert(userID int, url string) (int, error)
+	Get(id, userID int) (*Webhook, error)
+	ForUser(userID int) ([]*Webhook, error)
+	Delete(id, userID int) error
+	Enqueue(userID int, event WebhookEvent, payload []byte) error
+	EnqueueFor(webhookID int, event WebhookEvent, payload []byte) error
+	Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	Save(d *WebhookDelivery) error
+	Deliveries(webhookID, limit int) ([]*WebhookDelivery, error)
+}
+
+// Webhook is a registered URL. The secret signs every payload sent to it, so
+// unlike API tokens it has to be stored as it is.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Created time.Time
+}
+
+// WebhookDelivery is one event queued for one webhook, together with the
+// outcome of the latest attempt to send it. LastAttempt is zero until the
+// first attempt.
+type WebhookDelivery struct {
+	ID           int
+	WebhookID    int
+	Event        WebhookEvent
+	Payload      []byte
+	Status       DeliveryStatus
+	Attempts     int
+	NextAttempt  time.Time
+	ResponseCode int
+	Error        string
+	Created      time.Time
+	LastAttempt  time.Time
+	// URL and Secret are the webhook's, filled in by Claim so that the
+	// delivery can be sent without looking the webhook up again.
+	URL    string
+	Secret string
+}
+
+// Record updates the delivery with the outcome of an attempt made at now:
+// the response code, or the error if no response arrived. Anything but a 2xx
+// response is retried after WebhookBackoff, until MaxWebhookAttempts.
+func (d *WebhookDelivery) Record(code int, err error, now time.Time) {
+	d.Attempts++
+	d.LastAttempt = now
+	d.ResponseCode = code
+	d.Error = ""
+	switch {
+	case err != nil:
+		d.Error = err.Error()
+	case code < 200 || code > 299:
+		d.Error = fmt.Sprintf("the receiver answered %d", code)
+	default:
+		d.Status = DeliveryDelivered
+		return
+	}
+	d.Error = truncate(d.Error, 255)
+	if d.Attempts >= MaxWebhookAttempts {
+		d.Status = DeliveryFailed
+		return
+	}
+	d.Status = DeliveryPending
+	d.NextAttempt = now.Add(WebhookBackoff(d.Attempts))
+}
+
+// NewWebhookSecret returns a random secret for signing payloads.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert registers a webhook with a new secret and returns its ID.
+func (m *WebhookModel) Insert(userID int, url string) (int, error) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return 0, err
+	}
+	stmt := `INSERT INTO webhooks (user_id, url, secret, created)
+	VALUES (?, ?, ?, ?)`
+	return insertID(context.Background(), dialectOf(m.DB), m.DB, stmt, userID, url, secret, now())
+}
+
+// Get returns one of the user's webhooks. It returns ErrNoRecord if the
+// webhook doesn't exist or belongs to somebody else.
+func (m *WebhookModel) Get(id, userID int) (*Webhook, error) {
+	stmt := "SELECT id, user_id, url, secret, created FROM webhooks WHERE id = ? AND user_id = ?"
+	h := &Webhook{}
+	err := m.DB.QueryRow(stmt, id, userID).Scan(&h.ID, &h.UserID, &h.URL, &h.Secret, &h.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return h, nil
+}
+
+// ForUser returns the user's webhooks, oldest first.
+func (m *WebhookModel) ForUser(userID int) ([]*Webhook, error) {
+	stmt := "SELECT id, user_id, url, secret, created FROM webhooks WHERE user_id = ? ORDER BY id"
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []*Webhook{}
+	for rows.Next() {
+		h := &Webhook{}
+		err = rows.Scan(&h.ID, &h.UserID, &h.URL, &h.Secret, &h.Created)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// Delete removes one of the user's webhooks together with its deliveries,
+// including any that haven't been sent yet.
+func (m *WebhookModel) Delete(id, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const enqueueStmt = `INSERT INTO webhook_deliveries
+	(webhook_id, event, payload, status, attempts, next_attempt, response_code, error, created)
+	VALUES (?, ?, ?, ?, 0, ?, 0, '', ?)`
+
+// Enqueue queues an event for every webhook of the user. It does nothing if
+// the user has no webhooks. The webhooks are looked up first, rather than
+// with INSERT ... SELECT, because Postgres can't tell the types of
+// placeholders in a SELECT list.
+func (m *WebhookModel) Enqueue(userID int, event WebhookEvent, payload []byte) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM webhooks WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	var webhookIDs []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		webhookIDs = append(webhookIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	at := now()
+	for _, id := range webhookIDs {
+		_, err = tx.Exec(enqueueStmt, id, event, payload, DeliveryPending, at, at)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// EnqueueFor queues an event for a single webhook.
+func (m *WebhookModel) EnqueueFor(webhookID int, event WebhookEvent, payload []byte) error {
+	at := now()
+	_, err := m.DB.Exec(enqueueStmt, webhookID, event, payload, DeliveryPending, at, at)
+	return err
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt,
+	d.response_code, d.error, d.created, d.last_attempt, h.url, h.secret`
+
+func scanDelivery(rows *sql.Rows) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var lastAttempt sql.NullTime
+	err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttempt,
+		&d.ResponseCode, &d.Error, &d.Created, &lastAttempt, &d.URL, &d.Secret)
+	if err != nil {
+		return nil, err
+	}
+	d.LastAttempt = lastAttempt.Time
+	return d, nil
+}
+
+func queryDeliveries(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}, stmt string, args ...any) ([]*WebhookDelivery, error) {
+	rows, err := q.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Claim returns up to limit pending deliveries which are due, and pushes
+// their next attempt back by lease, so that other workers leave them alone
+// while they are being sent. If the worker dies before calling Save, they are
+// picked up again once the lease runs out. The deliveries come back oldest
+// first, so that each webhook gets its events in order. On MySQL, SKIP LOCKED stops
+// workers on different instances from waiting for each other; SQLite only
+// has one writer at a time anyway.
+func (m *WebhookModel) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `SELECT id FROM webhook_deliveries
+	WHERE status = ? AND next_attempt <= ?
+	ORDER BY next_attempt, id LIMIT ?`
+	if dialectOf(m.DB) != dialectSQLite {
+		stmt += " FOR UPDATE SKIP LOCKED"
+	}
+	rows, err := tx.Query(stmt, DeliveryPending, now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*WebhookDelivery{}, nil
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	leaseArgs := append([]any{time.Now().UTC().Add(lease)}, ids...)
+	_, err = tx.Exec("UPDATE webhook_deliveries SET next_attempt = ? WHERE id IN ("+in+")", leaseArgs...)
+	if err != nil {
+		return nil, err
+	}
+	stmt = "SELECT " + deliveryColumns + ` FROM webhook_deliveries d
+	INNER JOIN webhooks h ON h.id = d.webhook_id
+	WHERE d.id IN (` + in + ") ORDER BY d.id"
+	deliveries, err := queryDeliveries(tx, stmt, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit()
+}
+
+// Save stores the outcome of an attempt, as recorded by WebhookDelivery.Record.
+func (m *WebhookModel) Save(d *WebhookDelivery) error {
+	stmt := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt = ?,
+	response_code = ?, error = ?, last_attempt = ? WHERE id = ?`
+	_, err := m.DB.Exec(stmt, d.Status, d.Attempts, d.NextAttempt.UTC(), d.ResponseCode, d.Error, d.LastAttempt.UTC(), d.ID)
+	return err
+}
+
+// Deliveries returns the latest deliveries of a webhook, newest first.
+func (m *WebhookModel) Deliveries(webhookID, limit int) ([]*WebhookDelivery, error) {
+	stmt := "SELECT " + deliveryColumns + ` FROM webhook_deliveries d
+	INNER JOIN webhooks h ON h.id = d.webhook_id
+	WHERE d.webhook_id = ? ORDER BY d.id DESC LIMIT ?`
+	return queryDeliveries(m.DB, stmt, webhookID, limit)
+}
+
+// MemoryWebhookModel is WebhookModel for a MemoryDB. Claim leases deliveries
+// in the same way, although only the workers of one process can share a
+// MemoryDB.
+type MemoryWebhookModel struct {
+	DB *MemoryDB
+}
+
+func (m *MemoryWebhookModel) Insert(userID int, url string) (int, error) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		return 0, err
+	}
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	h := &Webhook{ID: m.DB.nextID("webhooks"), UserID: userID, URL: url, Secret: secret, Created: now()}
+	m.DB.webhooks = append(m.DB.webhooks, h)
+	return h.ID, nil
+}
+
+// webhook returns the webhook with the given ID, or nil. The caller must hold
+// the lock.
+func (m *MemoryWebhookModel) webhook(id int) *Webhook {
+	for _, h := range m.DB.webhooks {
+		if h.ID == id {
+			return h
+		}
+	}
+	return nil
+}
+
+func (m *MemoryWebhookModel) Get(id, userID int) (*Webhook, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	h := m.webhook(id)
+	if h == nil || h.UserID != userID {
+		return nil, ErrNoRecord
+	}
+	c := *h
+	return &c, nil
+}
+
+func (m *MemoryWebhookModel) ForUser(userID int) ([]*Webhook, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	hooks := []*Webhook{}
+	for _, h := range m.DB.webhooks {
+		if h.UserID == userID {
+			c := *h
+			hooks = append(hooks, &c)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *MemoryWebhookModel) Delete(id, userID int) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	var n int
+	m.DB.webhooks, n = deleteWhere(m.DB.webhooks, func(h *Webhook) bool { return h.ID == id && h.UserID == userID })
+	if n == 0 {
+		return ErrNoRecord
+	}
+	m.DB.deliveries, _ = deleteWhere(m.DB.deliveries, func(d *WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+// enqueue queues an event for the webhook. The caller must hold the lock.
+func (m *MemoryWebhookModel) enqueue(webhookID int, event WebhookEvent, payload []byte) {
+	at := now()
+	m.DB.deliveries = append(m.DB.deliveries, &WebhookDelivery{
+		ID:          m.DB.nextID("webhook_deliveries"),
+		WebhookID:   webhookID,
+		Event:       event,
+		Payload:     bytes.Clone(payload),
+		Status:      DeliveryPending,
+		NextAttempt: at,
+		Created:     at,
+	})
+}
+
+func (m *MemoryWebhookModel) Enqueue(userID int, event WebhookEvent, payload []byte) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	for _, h := range m.DB.webhooks {
+		if h.UserID == userID {
+			m.enqueue(h.ID, event, payload)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryWebhookModel) EnqueueFor(webhookID int, event WebhookEvent, payload []byte) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	m.enqueue(webhookID, event, payload)
+	return nil
+}
+
+// delivery returns a copy of the delivery with its webhook's URL and secret,
+// or nil if the webhook no longer exists. The caller must hold the lock.
+func (m *MemoryWebhookModel) delivery(d *WebhookDelivery) *WebhookDelivery {
+	h := m.webhook(d.WebhookID)
+	if h == nil {
+		return nil
+	}
+	c := *d
+	c.Payload = bytes.Clone(d.Payload)
+	c.URL, c.Secret = h.URL, h.Secret
+	return &c
+}
+
+func (m *MemoryWebhookModel) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	at := now()
+	var due []*WebhookDelivery
+	for _, d := range m.DB.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttempt.After(at) {
+			due = append(due, d)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	due = due[:min(limit, len(due))]
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	deliveries := []*WebhookDelivery{}
+	for _, d := range due {
+		d.NextAttempt = time.Now().UTC().Add(lease)
+		if c := m.delivery(d); c != nil {
+			deliveries = append(deliveries, c)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *MemoryWebhookModel) Save(d *WebhookDelivery) error {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	for _, stored := range m.DB.deliveries {
+		if stored.ID == d.ID {
+			stored.Status = d.Status
+			stored.Attempts = d.Attempts
+			stored.NextAttempt = d.NextAttempt.UTC()
+			stored.ResponseCode = d.ResponseCode
+			stored.Error = d.Error
+			stored.LastAttempt = d.LastAttempt.UTC()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryWebhookModel) Deliveries(webhookID, limit int) ([]*WebhookDelivery, error) {
+	m.DB.mu.Lock()
+	defer m.DB.mu.Unlock()
+	deliveries := []*WebhookDelivery{}
+	for i := len(m.DB.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := m.DB.deliveries[i]; d.WebhookID == webhookID {
+			if c := m.delivery(d); c != nil {
+				deliveries = append(deliveries, c)
+			}
+		}
+	}
+	return deliveries, nil
+}
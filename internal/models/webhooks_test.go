@@ -0,0 +1,43 @@
+package models
+
+import (
+	"GoWebPractice/internal/assert"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhookDeliveryRecord(t *testing.T) {
+	now := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		attempts        int
+		code            int
+		err             error
+		wantStatus      DeliveryStatus
+		wantNextAttempt time.Time
+		wantError       string
+	}{
+		{name: "Delivered", code: 204, wantStatus: DeliveryDelivered},
+		{name: "Server error", code: 500, wantStatus: DeliveryPending, wantNextAttempt: now.Add(30 * time.Second), wantError: "the receiver answered 500"},
+		{name: "Redirect", code: 302, wantStatus: DeliveryPending, wantNextAttempt: now.Add(30 * time.Second), wantError: "the receiver answered 302"},
+		{name: "Backs off", attempts: 3, err: errors.New("connection refused"), wantStatus: DeliveryPending, wantNextAttempt: now.Add(4 * time.Minute), wantError: "connection refused"},
+		{name: "Gives up", attempts: MaxWebhookAttempts - 1, code: 503, wantStatus: DeliveryFailed, wantError: "the receiver answered 503"},
+		{name: "Late success", attempts: MaxWebhookAttempts - 1, code: 200, wantStatus: DeliveryDelivered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &WebhookDelivery{Status: DeliveryPending, Attempts: tt.attempts, Error: "earlier failure"}
+			d.Record(tt.code, tt.err, now)
+			assert.Equal(t, d.Status, tt.wantStatus)
+			assert.Equal(t, d.Attempts, tt.attempts+1)
+			assert.Equal(t, d.LastAttempt, now)
+			assert.Equal(t, d.ResponseCode, tt.code)
+			assert.Equal(t, d.Error, tt.wantError)
+			if !tt.wantNextAttempt.IsZero() {
+				assert.Equal(t, d.NextAttempt, tt.wantNextAttempt)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SecretRule decides whether a single line of text looks like it contains a
+// secret, such as an API key or a password.
+type SecretRule interface {
+	Name() string
+	Match(line string) bool
+}
+
+// RegexRule matches lines against a regular expression. It is meant for
+// secrets with a well-known format, like AWS access keys.
+type RegexRule struct {
+	RuleName string
+	Pattern  *regexp.Regexp
+}
+
+func (r RegexRule) Name() string {
+	return r.RuleName
+}
+
+func (r RegexRule) Match(line string) bool {
+	return r.Pattern.MatchString(line)
+}
+
+// EntropyRule matches lines containing a word of at least MinLength characters
+// whose Shannon entropy is at least Threshold bits per character. Random
+// tokens score highly; English words and identifiers don't. A word of n
+// characters has at most log2(n) bits per character, so words too short to
+// reach Threshold need to come within entropySlack of that maximum instead.
+type EntropyRule struct {
+	RuleName  string
+	MinLength int
+	Threshold float64
+}
+
+// entropySlack is how far below the highest possible entropy a short word may
+// score and still match. Random base62 words of 20 characters average 4.0
+// bits per character, out of at most 4.32.
+const entropySlack = 0.5
+
+func (r EntropyRule) Name() string {
+	return r.RuleName
+}
+
+func (r EntropyRule) Match(line string) bool {
+	for _, word := range secretWordRX.FindAllString(line, -1) {
+		n := utf8.RuneCountInString(word)
+		if n >= r.MinLength && entropy(word) >= min(r.Threshold, math.Log2(float64(n))-entropySlack) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretWordRX splits a line into the words that EntropyRule looks at. It
+// covers the characters used by base64, hex and most token formats.
+var secretWordRX = regexp.MustCompile(`[A-Za-z0-9+/=_\-]+`)
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// SecretFinding is a line which matched one of the rules. Line numbers start
+// at one.
+type SecretFinding struct {
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	Text string `json:"text"`
+}
+
+// maxFindingText is how much of a matching line is kept in a SecretFinding.
+const maxFindingText = 80
+
+// SecretScanner runs a set of rules over every line of a text.
+type SecretScanner struct {
+	Rules []SecretRule
+}
+
+// Scan returns the lines of content which match any of the rules. Each line
+// is reported once, for the first rule it matches.
+func (s *SecretScanner) Scan(content string) []SecretFinding {
+	var findings []SecretFinding
+	for i, line := range strings.Split(content, "\n") {
+		for _, rule := range s.Rules {
+			if rule.Match(line) {
+				text := strings.TrimSpace(line)
+				if utf8.RuneCountInString(text) > maxFindingText {
+					text = string([]rune(text)[:maxFindingText]) + "…"
+				}
+				findings = append(findings, SecretFinding{Line: i + 1, Rule: rule.Name(), Text: text})
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// DefaultSecretRules catch the most common kinds of leaked credentials.
+func DefaultSecretRules() []SecretRule {
+	return []SecretRule{
+		RegexRule{RuleName: "Private key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+		RegexRule{RuleName: "AWS access key", Pattern: regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		RegexRule{RuleName: "GitHub token", Pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+		RegexRule{RuleName: "Snippetbox API token", Pattern: regexp.MustCompile(`\bsbx_[A-Za-z0-9_-]{43}`)},
+		RegexRule{RuleName: "Slack token", Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+		RegexRule{RuleName: "Password assignment", Pattern: regexp.MustCompile(`(?i)\b(password|passwd|secret|api_?key)\s*[:=]\s*['"]?[^\s'"]{8,}`)},
+		EntropyRule{RuleName: "High entropy string", MinLength: 20, Threshold: 4.5},
+	}
+}
+
+// secretRuleFile is the JSON format read by LoadSecretRules, for example:
+//
+//	{"rules": [
+//		{"name": "AWS access key", "type": "regex", "pattern": "AKIA[0-9A-Z]{16}"},
+//		{"name": "High entropy string", "type": "entropy", "min_length": 20, "threshold": 4.5}
+//	]}
+type secretRuleFile struct {
+	Rules []struct {
+		Name      string  `json:"name"`
+		Type      string  `json:"type"`
+		Pattern   string  `json:"pattern"`
+		MinLength int     `json:"min_length"`
+		Threshold float64 `json:"threshold"`
+	} `json:"rules"`
+}
+
+// LoadSecretRules reads a set of rules in the JSON format described by
+// secretRuleFile.
+func LoadSecretRules(r io.Reader) ([]SecretRule, error) {
+	var file secretRuleFile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&file)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]SecretRule, 0, len(file.Rules))
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("secret rule %d: missing name", i+1)
+		}
+		switch rule.Type {
+		case "regex":
+			rx, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("secret rule %q: %w", rule.Name, err)
+			}
+			rules = append(rules, RegexRule{RuleName: rule.Name, Pattern: rx})
+		case "entropy":
+			if rule.MinLength < 1 || rule.Threshold <= 0 {
+				return nil, fmt.Errorf("secret rule %q: min_length and threshold must be positive", rule.Name)
+			}
+			rules = append(rules, EntropyRule{RuleName: rule.Name, MinLength: rule.MinLength, Threshold: rule.Threshold})
+		default:
+			return nil, fmt.Errorf("secret rule %q: unknown type %q", rule.Name, rule.Type)
+		}
+	}
+	return rules, nil
+}
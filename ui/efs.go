@@ -4,7 +4,7 @@ import (
 	"embed"
 )
 
-//go:embed "html" "static"
+//go:embed "html" "static" "api"
 var Files embed.FS
 
 // 嵌入式檔案系統始終根位於包含 go:embed 指令的目錄中。